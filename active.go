@@ -0,0 +1,76 @@
+package main
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+const allSoundOffCC = 120
+
+// activeNotes tracks the notes sounding on the midi out device, as of
+// the messages written to it.
+type activeNotes struct {
+	mu    sync.Mutex
+	notes map[noteKey]time.Time
+}
+
+type activeNote struct {
+	Channel byte  `json:"channel"`
+	Note    byte  `json:"note"`
+	HeldMs  int64 `json:"held_ms"`
+}
+
+func newActiveNotes() *activeNotes {
+	return &activeNotes{notes: map[noteKey]time.Time{}}
+}
+
+// update follows data into the table. It returns false for a note off of
+// a note that is not sounding.
+func (a *activeNotes) update(data []byte) bool {
+	if len(data) < 3 || data[0] >= SysExC {
+		return true
+	}
+	msg := Midi{State: data[0] >> 4, Channel: data[0] & 0x0f, Note: data[1], Velocity: data[2]}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	switch {
+	case msg.isNoteOn():
+		if _, ok := a.notes[msg.key()]; !ok {
+			a.notes[msg.key()] = time.Now()
+		}
+	case msg.isNoteOff():
+		if _, ok := a.notes[msg.key()]; !ok {
+			return false
+		}
+		delete(a.notes, msg.key())
+	case msg.isCC(allNotesOffCC), msg.isCC(allSoundOffCC):
+		for k := range a.notes {
+			if k.Channel == msg.Channel {
+				delete(a.notes, k)
+			}
+		}
+	}
+
+	return true
+}
+
+func (a *activeNotes) list() []activeNote {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	notes := []activeNote{}
+	for k, at := range a.notes {
+		notes = append(notes, activeNote{k.Channel, k.Note, time.Since(at).Milliseconds()})
+	}
+	sort.Slice(notes, func(i, j int) bool {
+		if notes[i].Channel != notes[j].Channel {
+			return notes[i].Channel < notes[j].Channel
+		}
+		return notes[i].Note < notes[j].Note
+	})
+
+	return notes
+}
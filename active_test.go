@@ -0,0 +1,161 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestActiveNotesUpdate(t *testing.T) {
+	tests := []struct {
+		name string
+		data [][]byte
+		// stray is the index of the message update reports as a stray
+		// note off, -1 for none
+		stray int
+		want  []noteKey
+	}{
+		{
+			name:  "on and off",
+			data:  [][]byte{{0x90, 60, 100}, {0x91, 62, 100}, {0x80, 60, 0}},
+			stray: -1,
+			want:  []noteKey{{1, 62}},
+		},
+		{
+			name:  "velocity 0 releases",
+			data:  [][]byte{{0x90, 60, 100}, {0x90, 60, 0}},
+			stray: -1,
+		},
+		{
+			name:  "stray note off",
+			data:  [][]byte{{0x90, 60, 100}, {0x80, 62, 0}},
+			stray: 1,
+			want:  []noteKey{{0, 60}},
+		},
+		{
+			name:  "all notes off clears its channel",
+			data:  [][]byte{{0x90, 60, 100}, {0x90, 64, 100}, {0x93, 60, 100}, {0xB0, allNotesOffCC, 0}},
+			stray: -1,
+			want:  []noteKey{{3, 60}},
+		},
+		{
+			name:  "all sound off clears its channel",
+			data:  [][]byte{{0x93, 60, 100}, {0xB3, allSoundOffCC, 0}, {0x83, 60, 0}},
+			stray: 2,
+		},
+		{
+			name:  "restruck note is one entry",
+			data:  [][]byte{{0x90, 60, 100}, {0x90, 60, 90}, {0x80, 60, 0}, {0x80, 60, 0}},
+			stray: 3,
+		},
+		{
+			name:  "other messages",
+			data:  [][]byte{{0xB0, 7, 100}, {0xF8}, {0xC0, 1}},
+			stray: -1,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a := newActiveNotes()
+			for i, data := range tt.data {
+				if ok := a.update(data); ok != (i != tt.stray) {
+					t.Errorf("update(% X) = %v", data, ok)
+				}
+			}
+
+			var got []noteKey
+			for _, n := range a.list() {
+				got = append(got, noteKey{n.Channel, n.Note})
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("sounding %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestActiveNotesCommand(t *testing.T) {
+	quiet(t)
+
+	const held = 20 * time.Millisecond
+
+	conn := &packetConn{}
+	m, _ := testBridge(t, func(m *MidiBridge) { m.Conn = conn })
+	m.handleCmd([]byte(activeCall), udpAddr(1))
+	m.handleCmd(legacyPacket(0x92, 64, 100), nil)
+	m.handleCmd(legacyPacket(0x90, 60, 100), nil)
+	time.Sleep(held)
+	m.handleCmd([]byte(activeCall), udpAddr(1))
+
+	sent := conn.packets()
+	if len(sent) != 2 {
+		t.Fatalf("%d replies, want 2", len(sent))
+	}
+	if string(sent[0].data) != "[]" {
+		t.Errorf("replied %s with nothing sounding, want []", sent[0].data)
+	}
+
+	var notes []activeNote
+	if err := json.Unmarshal(sent[1].data, &notes); err != nil {
+		t.Fatal(err)
+	}
+	if len(notes) != 2 || notes[0].Channel != 0 || notes[0].Note != 60 || notes[1].Channel != 2 || notes[1].Note != 64 {
+		t.Fatalf("replied %+v, want 0:60 and 2:64", notes)
+	}
+	for _, n := range notes {
+		if n.HeldMs < held.Milliseconds() {
+			t.Errorf("%+v held for less than %v", n, held)
+		}
+	}
+}
+
+func TestDropStrayOffs(t *testing.T) {
+	writes := [][]byte{
+		{0x80, 60, 0},
+		{0x90, 60, 100},
+		{0x80, 60, 0},
+		{0x80, 60, 0},
+		{0x90, 62, 100},
+		{0xB0, allNotesOffCC, 0},
+		{0x90, 62, 0},
+		{0x91, 62, 0},
+	}
+
+	tests := []struct {
+		drop  bool
+		want  []byte
+		drops []string
+	}{
+		{
+			drop: false,
+			want: []byte{
+				0x80, 60, 0, 0x90, 60, 100, 0x80, 60, 0, 0x80, 60, 0,
+				0x90, 62, 100, 0xB0, allNotesOffCC, 0, 0x90, 62, 0, 0x91, 62, 0,
+			},
+		},
+		{
+			drop:  true,
+			want:  []byte{0x90, 60, 100, 0x80, 60, 0, 0x90, 62, 100, 0xB0, allNotesOffCC, 0},
+			drops: []string{"stray-note-off", "stray-note-off", "stray-note-off", "stray-note-off"},
+		},
+	}
+
+	for _, tt := range tests {
+		m, out := testBridge(t, func(m *MidiBridge) { m.DropStrayOffs = tt.drop })
+		d := recordDrops(m)
+		for _, data := range writes {
+			m.Write(data)
+		}
+		m.Close()
+
+		if got := out.Bytes(); !bytes.Equal(got, tt.want) {
+			t.Errorf("drop %v: wrote % X\nwant  % X", tt.drop, got, tt.want)
+		}
+		if got := d.reasons(); !reflect.DeepEqual(got, tt.drops) {
+			t.Errorf("drop %v: dropped for %q, want %q", tt.drop, got, tt.drops)
+		}
+	}
+}
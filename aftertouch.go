@@ -0,0 +1,57 @@
+package main
+
+import "math"
+
+// AftertouchToCC turns channel pressure and poly aftertouch into
+// controller cc, scaling the pressure by scale. Poly aftertouch sends the
+// strongest pressure of the notes held on the channel.
+func AftertouchToCC(cc byte, scale float64) Transform {
+	pressure := map[noteKey]byte{}
+
+	toCC := func(channel, p byte) []Midi {
+		v := math.Round(float64(p) * scale)
+		return []Midi{{
+			State:    ContinuousContr >> 4,
+			Channel:  channel,
+			Note:     cc,
+			Velocity: byte(math.Max(0, math.Min(127, v))),
+		}}
+	}
+
+	return func(msg Midi) []Midi {
+		switch {
+		case msg.Command() == ChannelPressure:
+			// channel pressure has a single data byte
+			return toCC(msg.Channel, msg.Note)
+
+		case msg.Command() == Aftertouch:
+			if msg.Velocity == 0 {
+				delete(pressure, msg.key())
+			} else {
+				pressure[msg.key()] = msg.Velocity
+			}
+
+		case msg.isNoteOff():
+			if _, ok := pressure[msg.key()]; !ok {
+				return []Midi{msg}
+			}
+			delete(pressure, msg.key())
+			return append([]Midi{msg}, toCC(msg.Channel, maxPressure(pressure, msg.Channel))...)
+
+		default:
+			return []Midi{msg}
+		}
+
+		return toCC(msg.Channel, maxPressure(pressure, msg.Channel))
+	}
+}
+
+func maxPressure(pressure map[noteKey]byte, channel byte) byte {
+	var max byte
+	for k, p := range pressure {
+		if k.Channel == channel && p > max {
+			max = p
+		}
+	}
+	return max
+}
@@ -0,0 +1,64 @@
+package main
+
+import "testing"
+
+func TestAftertouchToCC(t *testing.T) {
+	channelPressure := func(ch, p byte) Midi {
+		return Midi{State: ChannelPressure >> 4, Channel: ch, Note: p}
+	}
+	poly := func(ch, note, p byte) Midi {
+		return Midi{State: Aftertouch >> 4, Channel: ch, Note: note, Velocity: p}
+	}
+
+	tests := []struct {
+		name  string
+		scale float64
+		steps []transformStep
+	}{
+		{
+			name:  "channel pressure",
+			scale: 1,
+			steps: []transformStep{
+				{channelPressure(2, 90), []Midi{cc(2, 1, 90)}},
+				{channelPressure(2, 0), []Midi{cc(2, 1, 0)}},
+			},
+		},
+		{
+			name:  "scaled and clamped",
+			scale: 1.5,
+			steps: []transformStep{
+				{channelPressure(0, 40), []Midi{cc(0, 1, 60)}},
+				{channelPressure(0, 100), []Midi{cc(0, 1, 127)}},
+			},
+		},
+		{
+			name:  "poly aftertouch sends the strongest note",
+			scale: 1,
+			steps: []transformStep{
+				{noteOn(0, 60, 100), []Midi{noteOn(0, 60, 100)}},
+				{noteOn(0, 64, 100), []Midi{noteOn(0, 64, 100)}},
+				{poly(0, 60, 50), []Midi{cc(0, 1, 50)}},
+				{poly(0, 64, 80), []Midi{cc(0, 1, 80)}},
+				{poly(0, 60, 70), []Midi{cc(0, 1, 80)}},
+				{poly(1, 60, 10), []Midi{cc(1, 1, 10)}},
+				{noteOff(0, 64), []Midi{noteOff(0, 64), cc(0, 1, 70)}},
+				{poly(0, 60, 0), []Midi{cc(0, 1, 0)}},
+				{noteOff(0, 60), []Midi{noteOff(0, 60)}},
+			},
+		},
+		{
+			name:  "other messages pass",
+			scale: 1,
+			steps: []transformStep{
+				{cc(0, 7, 90), []Midi{cc(0, 7, 90)}},
+				{bend(0, 100), []Midi{bend(0, 100)}},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			runSteps(t, AftertouchToCC(1, tt.scale), tt.steps)
+		})
+	}
+}
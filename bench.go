@@ -0,0 +1,166 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// bench holds the drone note and sweep the bench tools keep running.
+type bench struct {
+	mu    sync.Mutex
+	drone *Midi
+	sweep chan struct{}
+	swept chan struct{}
+}
+
+func parseData(s string, max int) (byte, bool) {
+	n, err := strconv.Atoi(s)
+	if err != nil || n < 0 || n > max {
+		return 0, false
+	}
+	return byte(n), true
+}
+
+// handleDrone holds the note given as first argument on the channel given
+// as second, 0 if omitted, until /drone off.
+func (m *MidiBridge) handleDrone(args []string) {
+	if len(args) == 0 {
+		return
+	}
+
+	m.stopDrone()
+	if args[0] == "off" {
+		return
+	}
+
+	note, ok := parseData(args[0], 127)
+	if !ok {
+		fmt.Printf("drone note %q out of range [0-127]\n", args[0])
+		return
+	}
+	var channel byte
+	if len(args) > 1 {
+		if channel, ok = parseData(args[1], 15); !ok {
+			fmt.Printf("drone channel %q out of range [0-15]\n", args[1])
+			return
+		}
+	}
+
+	drone := Midi{State: NoteOn >> 4, Channel: channel, Note: note, Velocity: 100}
+
+	m.bench.mu.Lock()
+	m.bench.drone = &drone
+	m.bench.mu.Unlock()
+
+	m.Write(drone.Bytes())
+}
+
+func (m *MidiBridge) stopDrone() {
+	m.bench.mu.Lock()
+	drone := m.bench.drone
+	m.bench.drone = nil
+	m.bench.mu.Unlock()
+
+	if drone != nil {
+		drone.State = NoteOff >> 4
+		drone.Velocity = 0
+		m.Write(drone.Bytes())
+	}
+}
+
+// handleSweep sweeps the controller given as first argument, or pitch bend
+// for "pitchbend", up and down its range on the channel given as second, 0
+// if omitted, until /sweep off.
+func (m *MidiBridge) handleSweep(args []string) {
+	if len(args) == 0 {
+		return
+	}
+
+	m.stopSweep()
+	if args[0] == "off" {
+		return
+	}
+
+	target := Midi{State: PitchBend >> 4}
+	if args[0] != "pitchbend" {
+		cc, ok := parseData(args[0], 127)
+		if !ok {
+			fmt.Printf("sweep controller %q out of range [0-127]\n", args[0])
+			return
+		}
+		target = Midi{State: ContinuousContr >> 4, Note: cc}
+	}
+	if len(args) > 1 {
+		channel, ok := parseData(args[1], 15)
+		if !ok {
+			fmt.Printf("sweep channel %q out of range [0-15]\n", args[1])
+			return
+		}
+		target.Channel = channel
+	}
+
+	stop, swept := make(chan struct{}), make(chan struct{})
+
+	m.bench.mu.Lock()
+	m.bench.sweep, m.bench.swept = stop, swept
+	m.bench.mu.Unlock()
+
+	go m.sweep(target, stop, swept)
+}
+
+func (m *MidiBridge) sweep(target Midi, stop, swept chan struct{}) {
+	defer close(swept)
+
+	ticker := time.NewTicker(20 * time.Millisecond)
+	defer ticker.Stop()
+
+	start := time.Now()
+	last := -1
+	for {
+		select {
+		case <-stop:
+			if target.Command() == PitchBend {
+				target.Note, target.Velocity = 0, pitchBendCenter>>7
+				m.Write(target.Bytes())
+			}
+			return
+		case <-ticker.C:
+		}
+
+		// triangle going 0 to 1 and back once per period
+		phase := math.Mod(time.Since(start).Seconds()/m.SweepPeriod.Seconds(), 1)
+		level := 1 - math.Abs(2*phase-1)
+
+		if target.Command() == PitchBend {
+			v := int(math.Round(level * 16383))
+			if v == last {
+				continue
+			}
+			target.Note, target.Velocity = byte(v&0x7f), byte(v>>7)
+			last = v
+		} else {
+			v := int(math.Round(level * 127))
+			if v == last {
+				continue
+			}
+			target.Velocity = byte(v)
+			last = v
+		}
+		m.Write(target.Bytes())
+	}
+}
+
+func (m *MidiBridge) stopSweep() {
+	m.bench.mu.Lock()
+	stop, swept := m.bench.sweep, m.bench.swept
+	m.bench.sweep, m.bench.swept = nil, nil
+	m.bench.mu.Unlock()
+
+	if stop != nil {
+		close(stop)
+		<-swept
+	}
+}
@@ -0,0 +1,120 @@
+package main
+
+import (
+	"bytes"
+	"testing"
+	"time"
+)
+
+func TestDrone(t *testing.T) {
+	quiet(t)
+
+	tests := []struct {
+		name string
+		args [][]string
+		want []byte
+	}{
+		{
+			name: "held until off",
+			args: [][]string{{"60"}, {"off"}},
+			want: []byte{0x90, 60, 100, 0x80, 60, 0},
+		},
+		{
+			name: "a new drone replaces the old",
+			args: [][]string{{"60", "3"}, {"62", "3"}},
+			// Close stops the last one
+			want: []byte{0x93, 60, 100, 0x83, 60, 0, 0x93, 62, 100, 0x83, 62, 0},
+		},
+		{
+			name: "out of range",
+			args: [][]string{{"128"}, {"60", "16"}, {"x"}, {}},
+		},
+		{
+			name: "off without a drone",
+			args: [][]string{{"off"}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m, out := testBridge(t, nil)
+			for _, args := range tt.args {
+				m.handleCmd(oscMessage(droneCall, args...), nil)
+			}
+			m.Close()
+
+			if got := out.Bytes(); !bytes.Equal(got, tt.want) {
+				t.Errorf("wrote % X, want % X", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSweepController(t *testing.T) {
+	quiet(t)
+
+	const period = 400 * time.Millisecond
+
+	m, out := testBridge(t, func(m *MidiBridge) { m.SweepPeriod = period })
+	m.handleCmd(oscMessage(sweepCall, "7", "2"), nil)
+	time.Sleep(period / 4)
+	m.handleCmd(oscMessage(sweepCall, "off"), nil)
+	time.Sleep(20 * time.Millisecond)
+	written := len(out.Bytes())
+	time.Sleep(60 * time.Millisecond)
+	m.Close()
+
+	got := out.Bytes()
+	if len(got) != written {
+		t.Errorf("still sweeping after /sweep off")
+	}
+	if len(got) < 3*3 || len(got)%3 != 0 {
+		t.Fatalf("wrote % X, want a few controller values", got)
+	}
+	// a quarter period is not past the top
+	last := -1
+	for i := 0; i < len(got); i += 3 {
+		if got[i] != 0xB2 || got[i+1] != 7 {
+			t.Fatalf("wrote % X, want controller 7 on channel 2", got[i:i+3])
+		}
+		if v := int(got[i+2]); v <= last {
+			t.Errorf("value %d after %d, want rising", v, last)
+		}
+		last = int(got[i+2])
+	}
+}
+
+func TestSweepPitchBendRecenters(t *testing.T) {
+	quiet(t)
+
+	m, out := testBridge(t, func(m *MidiBridge) { m.SweepPeriod = time.Second })
+	m.handleCmd(oscMessage(sweepCall, "pitchbend"), nil)
+	time.Sleep(50 * time.Millisecond)
+	// a new sweep stops the running one
+	m.handleCmd(oscMessage(sweepCall, "1"), nil)
+	m.handleCmd(oscMessage(sweepCall, "off"), nil)
+	m.Close()
+
+	got := out.Bytes()
+	if len(got) < 6 || got[0] != 0xE0 {
+		t.Fatalf("wrote % X, want pitch bend", got)
+	}
+	if center := []byte{0xE0, 0, 64}; !bytes.HasSuffix(got, center) {
+		t.Errorf("wrote % X, want it to end on the center % X", got, center)
+	}
+}
+
+func TestSweepOutOfRange(t *testing.T) {
+	quiet(t)
+
+	m, out := testBridge(t, func(m *MidiBridge) { m.SweepPeriod = time.Second })
+	for _, args := range [][]string{{"128"}, {"7", "16"}, {"bend"}} {
+		m.handleCmd(oscMessage(sweepCall, args...), nil)
+	}
+	time.Sleep(50 * time.Millisecond)
+	m.Close()
+
+	if got := out.Bytes(); len(got) != 0 {
+		t.Errorf("wrote % X", got)
+	}
+}
@@ -0,0 +1,52 @@
+package main
+
+const (
+	maxPitchBend = 16383
+	// bendLearnSpan is how far from the true center a bend may be to be
+	// taken for the resting position of the wheel.
+	bendLearnSpan = 512
+)
+
+// BendCenter recenters pitch bend from a wheel that doesn't rest at
+// pitchBendCenter. Center is mapped to pitchBendCenter and both halves
+// are stretched so the extents stay where they are. With learn the
+// center of every channel is taken from its first bend near the true
+// center instead, a wheel at rest sends that on startup or when let go.
+func BendCenter(center int, learn bool) Transform {
+	var centers [16]int
+	for ch := range centers {
+		centers[ch] = center
+		if learn {
+			centers[ch] = -1
+		}
+	}
+
+	return func(msg Midi) []Midi {
+		if msg.Command() != PitchBend {
+			return []Midi{msg}
+		}
+
+		bend := int(msg.Velocity)<<7 | int(msg.Note)
+
+		c := centers[msg.Channel]
+		if c < 0 {
+			if bend < pitchBendCenter-bendLearnSpan || bend > pitchBendCenter+bendLearnSpan {
+				return []Midi{msg}
+			}
+			centers[msg.Channel], c = bend, bend
+		}
+
+		switch {
+		case bend < c:
+			bend = bend * pitchBendCenter / c
+		case bend > c:
+			bend = pitchBendCenter + (bend-c)*(maxPitchBend-pitchBendCenter)/(maxPitchBend-c)
+		default:
+			bend = pitchBendCenter
+		}
+
+		msg.Note = byte(bend & 0x7f)
+		msg.Velocity = byte(bend >> 7)
+		return []Midi{msg}
+	}
+}
@@ -0,0 +1,61 @@
+package main
+
+import "testing"
+
+func bend(ch byte, v int) Midi {
+	return Midi{State: PitchBend >> 4, Channel: ch, Note: byte(v & 0x7f), Velocity: byte(v >> 7)}
+}
+
+func TestBendCenter(t *testing.T) {
+	tests := []struct {
+		name   string
+		center int
+		learn  bool
+		steps  []transformStep
+	}{
+		{
+			name:   "center and extents",
+			center: 8000,
+			steps: []transformStep{
+				{bend(0, 8000), []Midi{bend(0, pitchBendCenter)}},
+				{bend(0, 0), []Midi{bend(0, 0)}},
+				{bend(0, maxPitchBend), []Midi{bend(0, maxPitchBend)}},
+				{bend(0, 4000), []Midi{bend(0, 4096)}},
+				{bend(0, 12191), []Midi{bend(0, 12287)}},
+			},
+		},
+		{
+			name:   "true center is unchanged",
+			center: pitchBendCenter,
+			steps: []transformStep{
+				{bend(0, 100), []Midi{bend(0, 100)}},
+				{bend(0, pitchBendCenter), []Midi{bend(0, pitchBendCenter)}},
+				{bend(0, 16000), []Midi{bend(0, 16000)}},
+			},
+		},
+		{
+			name:  "learns per channel from a bend near center",
+			learn: true,
+			steps: []transformStep{
+				{bend(0, 0), []Midi{bend(0, 0)}},
+				{bend(0, 8300), []Midi{bend(0, pitchBendCenter)}},
+				{bend(0, 8300), []Midi{bend(0, pitchBendCenter)}},
+				{bend(1, 8192), []Midi{bend(1, pitchBendCenter)}},
+				{bend(1, 8300), []Midi{bend(1, 8300)}},
+			},
+		},
+		{
+			name:   "other messages pass",
+			center: 8000,
+			steps: []transformStep{
+				{noteOn(0, 60, 100), []Midi{noteOn(0, 60, 100)}},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			runSteps(t, BendCenter(tt.center, tt.learn), tt.steps)
+		})
+	}
+}
@@ -0,0 +1,102 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+)
+
+// channelize remaps everything played to ActiveChannel, like the channel
+// button of a keyboard. ChannelCC selects the channel, swept across the
+// controller's range, and is not forwarded itself. Note offs go to the
+// channel their note on went to.
+func (m *MidiBridge) channelize(msg Midi) []Midi {
+	if m.ChannelCC >= 0 && msg.isCC(byte(m.ChannelCC)) {
+		return m.setChannel(int(msg.Velocity) * 16 / 128)
+	}
+	if (msg.isNoteOn() || msg.isNoteOff()) && !m.routeNote(&msg) {
+		return nil
+	}
+	if m.ActiveChannel < 0 {
+		return []Midi{msg}
+	}
+
+	switch {
+	case msg.isNoteOn(), msg.isNoteOff():
+
+	case msg.Command() == Aftertouch:
+		ch, ok := m.channelNotes[msg.key()]
+		if !ok {
+			return nil
+		}
+		msg.Channel = ch
+
+	default:
+		msg.Channel = byte(m.ActiveChannel)
+	}
+
+	return []Midi{msg}
+}
+
+// routeNote sends a note on to the active channel, or leaves it on its own
+// with remapping off, and a note off to where its note on went. Either way
+// the note is followed, a channel switch has to release it. It returns
+// false for a note off whose note was released by a switch already.
+func (m *MidiBridge) routeNote(msg *Midi) bool {
+	k := msg.key()
+
+	if msg.isNoteOn() {
+		if m.ActiveChannel >= 0 {
+			msg.Channel = byte(m.ActiveChannel)
+		}
+		m.channelNotes[k] = msg.Channel
+		return true
+	}
+
+	if ch, ok := m.channelNotes[k]; ok {
+		delete(m.channelNotes, k)
+		msg.Channel = ch
+		return true
+	}
+	if m.channelReleased[k] {
+		delete(m.channelReleased, k)
+		return false
+	}
+	return true
+}
+
+// setChannel makes ch the active channel, -1 stops remapping. It returns
+// note offs for the notes still held on the old channel, their own note
+// offs would go to the new one.
+func (m *MidiBridge) setChannel(ch int) []Midi {
+	if ch == m.ActiveChannel {
+		return nil
+	}
+	fmt.Printf("Active channel %d\n", ch)
+	m.ActiveChannel = ch
+
+	var out []Midi
+	for k, c := range m.channelNotes {
+		out = append(out, Midi{State: NoteOff >> 4, Channel: c, Note: k.Note})
+		delete(m.channelNotes, k)
+		m.channelReleased[k] = true
+	}
+	return out
+}
+
+func (m *MidiBridge) handleChannel(args []string) {
+	if len(args) == 0 {
+		return
+	}
+	ch, err := strconv.Atoi(args[0])
+	if err != nil || ch < -1 || ch > 15 {
+		fmt.Printf("channel %q out of range [0-15, -1 disables]\n", args[0])
+		return
+	}
+
+	m.pipeline.Lock()
+	defer m.pipeline.Unlock()
+
+	for _, out := range m.setChannel(ch) {
+		m.Write(out.Bytes())
+	}
+}
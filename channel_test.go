@@ -0,0 +1,114 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func noteOn(ch, note, vel byte) Midi {
+	return Midi{State: NoteOn >> 4, Channel: ch, Note: note, Velocity: vel}
+}
+
+func noteOff(ch, note byte) Midi {
+	return Midi{State: NoteOff >> 4, Channel: ch, Note: note}
+}
+
+func cc(ch, cc, val byte) Midi {
+	return Midi{State: ContinuousContr >> 4, Channel: ch, Note: cc, Velocity: val}
+}
+
+func TestChannelize(t *testing.T) {
+	// each step is a message played, or a channel switch when switchTo
+	// is set, and what comes out
+	type step struct {
+		in       Midi
+		switchTo int
+		want     []Midi
+	}
+	tests := []struct {
+		name   string
+		active int
+		cc     int
+		steps  []step
+	}{
+		{
+			name:   "remaps to the active channel",
+			active: 2, cc: -1,
+			steps: []step{
+				{in: noteOn(0, 60, 100), want: []Midi{noteOn(2, 60, 100)}},
+				{in: cc(0, 7, 90), want: []Midi{cc(2, 7, 90)}},
+				{in: noteOff(0, 60), want: []Midi{noteOff(2, 60)}},
+			},
+		},
+		{
+			name:   "switch redirects and releases held notes",
+			active: 2, cc: -1,
+			steps: []step{
+				{in: noteOn(0, 60, 100), want: []Midi{noteOn(2, 60, 100)}},
+				{switchTo: 5, want: []Midi{noteOff(2, 60)}},
+				{in: noteOff(0, 60)},
+				{in: noteOn(0, 62, 100), want: []Midi{noteOn(5, 62, 100)}},
+				{in: noteOff(0, 62), want: []Midi{noteOff(5, 62)}},
+			},
+		},
+		{
+			name:   "switch releases notes played unmapped",
+			active: -1, cc: -1,
+			steps: []step{
+				{in: noteOn(0, 60, 100), want: []Midi{noteOn(0, 60, 100)}},
+				{switchTo: 3, want: []Midi{noteOff(0, 60)}},
+				{in: noteOff(0, 60)},
+				{in: noteOn(0, 64, 100), want: []Midi{noteOn(3, 64, 100)}},
+			},
+		},
+		{
+			name:   "switching remapping off releases too",
+			active: 4, cc: -1,
+			steps: []step{
+				{in: noteOn(0, 60, 100), want: []Midi{noteOn(4, 60, 100)}},
+				{switchTo: -1, want: []Midi{noteOff(4, 60)}},
+				{in: noteOff(0, 60)},
+				{in: noteOn(0, 60, 100), want: []Midi{noteOn(0, 60, 100)}},
+			},
+		},
+		{
+			name:   "stray note off passes unmapped",
+			active: -1, cc: -1,
+			steps: []step{
+				{in: noteOff(1, 60), want: []Midi{noteOff(1, 60)}},
+			},
+		},
+		{
+			name:   "control selects the channel and is swallowed",
+			active: -1, cc: 20,
+			steps: []step{
+				{in: noteOn(0, 60, 100), want: []Midi{noteOn(0, 60, 100)}},
+				{in: cc(0, 20, 40), want: []Midi{noteOff(0, 60)}},
+				{in: noteOn(0, 62, 100), want: []Midi{noteOn(5, 62, 100)}},
+				{in: cc(0, 20, 127), want: []Midi{noteOff(5, 62)}},
+				{in: noteOn(0, 64, 100), want: []Midi{noteOn(15, 64, 100)}},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := NewMidiBridge(nil, nil)
+			m.ActiveChannel, m.ChannelCC = tt.active, tt.cc
+
+			for i, s := range tt.steps {
+				var got []Midi
+				if s.in == (Midi{}) {
+					got = m.setChannel(s.switchTo)
+				} else {
+					got = m.channelize(s.in)
+				}
+				if len(got) != 0 || len(s.want) != 0 {
+					if !reflect.DeepEqual(got, s.want) {
+						t.Errorf("step %d: got %+v, want %+v", i, got, s.want)
+					}
+				}
+			}
+		})
+	}
+}
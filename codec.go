@@ -0,0 +1,135 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+)
+
+// Codec translates between network packets and midi messages. New payload
+// formats register a Codec and are picked up by handleCmd without touching
+// the rest of the bridge.
+type Codec interface {
+	Name() string
+	// Match reports whether req is in the codec's format, it is used to
+	// auto detect the codec of a packet.
+	Match(req []byte) bool
+	Decode(req []byte) ([]Midi, error)
+	// Encode returns the packets to send for msgs, as many as the format
+	// needs.
+	Encode(msgs []Midi) [][]byte
+}
+
+var (
+	codecs     = map[string]Codec{}
+	codecOrder []Codec
+)
+
+// RegisterCodec makes c available by name and to auto detection, codecs
+// are tried in the order they were registered.
+func RegisterCodec(c Codec) {
+	if _, ok := codecs[c.Name()]; ok {
+		log.Fatalf("codec %s registered twice", c.Name())
+	}
+	codecs[c.Name()] = c
+	codecOrder = append(codecOrder, c)
+}
+
+func detectCodec(req []byte) Codec {
+	for _, c := range codecOrder {
+		if c.Match(req) {
+			return c
+		}
+	}
+	return nil
+}
+
+func init() {
+	RegisterCodec(legacyCodec{})
+}
+
+// legacyCodec is the original 11 byte format, the OSC address /midi
+// followed by a midi blob with status, note and velocity in reverse order.
+type legacyCodec struct{}
+
+var legacyHeader = []byte("/midi\x00\x00\x00,m\x00\x00")
+
+func (legacyCodec) Name() string {
+	return "legacy"
+}
+
+func (legacyCodec) Match(req []byte) bool {
+	return bytes.HasPrefix(req, []byte(midiCall))
+}
+
+func (legacyCodec) Decode(req []byte) ([]Midi, error) {
+	req = req[len(midiCall):]
+	if len(req) != 11 {
+		return nil, fmt.Errorf("packet is %d bytes, want 11", len(req))
+	}
+	return []Midi{ToMidi(req)}, nil
+}
+
+// Encode returns a packet per message, legacy clients read exactly one
+// message from a packet.
+func (legacyCodec) Encode(msgs []Midi) [][]byte {
+	var packets [][]byte
+	for _, msg := range msgs {
+		packet := append([]byte(nil), legacyHeader...)
+		packets = append(packets, append(packet, 0, msg.Velocity, msg.Note, msg.State<<4|msg.Channel))
+	}
+	return packets
+}
+
+// legacyNote writes a legacy note packet straight to midi out when nothing
+// between decoding and writing would touch it, saving the decode, the
+// pipeline and their allocations for the most common packet. The midi
+// bytes are put in order in place, req is not used afterwards. It reports
+// whether req was handled.
+func (m *MidiBridge) legacyNote(req []byte) bool {
+	if len(req) != len(midiCall)+11 {
+		return false
+	}
+	data := req[len(req)-3:]
+	status, note, velocity := data[2], data[1], data[0]
+	if s := status & 0xf0; s != NoteOn && s != NoteOff || note > 0x7f || velocity > 0x7f {
+		return false
+	}
+
+	m.pipeline.Lock()
+	defer m.pipeline.Unlock()
+
+	if len(m.transforms) > 0 || m.Script != nil || m.hold.on ||
+		m.ActiveChannel >= 0 || m.CollapseCC > 0 || m.Echo {
+		return false
+	}
+
+	msg := Midi{State: status >> 4, Channel: status & 0x0f, Note: note, Velocity: velocity}
+	m.logMidi(msg)
+	// remapping is off, but a switch has to release the note
+	if !m.routeNote(&msg) {
+		return true
+	}
+	m.macros.record(msg)
+	data[0], data[2] = status, velocity
+	m.Write(data)
+	return true
+}
+
+// logMidi prints msg the way fmt's %+v does, without the allocations fmt
+// takes. It runs for every message and needs the pipeline lock.
+func (m *MidiBridge) logMidi(msg Midi) {
+	b := append(m.logBuf[:0], "MidiNote: {State:"...)
+	b = strconv.AppendUint(b, uint64(msg.State), 10)
+	b = append(b, " Channel:"...)
+	b = strconv.AppendUint(b, uint64(msg.Channel), 10)
+	b = append(b, " Note:"...)
+	b = strconv.AppendUint(b, uint64(msg.Note), 10)
+	b = append(b, " Velocity:"...)
+	b = strconv.AppendUint(b, uint64(msg.Velocity), 10)
+	b = append(b, "}\n"...)
+	os.Stdout.Write(b)
+	m.logBuf = b
+}
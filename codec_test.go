@@ -0,0 +1,167 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// textCodec stands in for a newer format, "/text status data1 data2" per
+// line in hex, any number of messages to a packet.
+type textCodec struct{}
+
+func (textCodec) Name() string { return "text" }
+
+func (textCodec) Match(req []byte) bool { return bytes.HasPrefix(req, []byte("/text ")) }
+
+func (textCodec) Decode(req []byte) ([]Midi, error) {
+	var msgs []Midi
+	for _, line := range strings.Split(string(req), "\n") {
+		var status, data1, data2 byte
+		if _, err := fmt.Sscanf(line, "/text %x %x %x", &status, &data1, &data2); err != nil {
+			return nil, err
+		}
+		msgs = append(msgs, Midi{State: status >> 4, Channel: status & 0x0f, Note: data1, Velocity: data2})
+	}
+	return msgs, nil
+}
+
+func (textCodec) Encode(msgs []Midi) [][]byte {
+	var lines []string
+	for _, msg := range msgs {
+		lines = append(lines, fmt.Sprintf("/text %02x %02x %02x", msg.State<<4|msg.Channel, msg.Note, msg.Velocity))
+	}
+	return [][]byte{[]byte(strings.Join(lines, "\n"))}
+}
+
+func init() {
+	RegisterCodec(textCodec{})
+}
+
+func TestLegacyCodecRoundTrip(t *testing.T) {
+	msgs := []Midi{noteOn(3, 60, 100), cc(0, 7, 90), noteOff(15, 127)}
+
+	packets := legacyCodec{}.Encode(msgs)
+	if len(packets) != len(msgs) {
+		t.Fatalf("%d packets for %d messages, want one each", len(packets), len(msgs))
+	}
+	for i, p := range packets {
+		if !(legacyCodec{}).Match(p) {
+			t.Errorf("packet % X not matched", p)
+		}
+		got, err := legacyCodec{}.Decode(p)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(got, msgs[i:i+1]) {
+			t.Errorf("decoded %+v, want %+v", got, msgs[i])
+		}
+	}
+}
+
+func TestEchoInInboundFormat(t *testing.T) {
+	quiet(t)
+
+	conn := &packetConn{}
+	m, _ := testBridge(t, func(m *MidiBridge) {
+		m.Conn = conn
+		m.Echo = true
+		// a transform turning one message into two
+		m.Use(func(msg Midi) []Midi {
+			return []Midi{msg, {State: msg.State, Channel: msg.Channel, Note: msg.Note + 12, Velocity: msg.Velocity}}
+		})
+	})
+
+	old, modern := udpAddr(1), udpAddr(2)
+	m.handleCmd(legacyPacket(0x90, 60, 100), old)
+	m.handleCmd([]byte("/text 91 40 64"), modern)
+
+	want := []sentPacket{
+		{legacyCodec{}.Encode([]Midi{noteOn(0, 60, 100)})[0], old.String()},
+		{legacyCodec{}.Encode([]Midi{noteOn(0, 72, 100)})[0], old.String()},
+		{[]byte("/text 91 40 64\n/text 91 4c 64"), modern.String()},
+	}
+	if got := conn.packets(); !reflect.DeepEqual(got, want) {
+		t.Errorf("replied %q\nwant    %q", got, want)
+	}
+}
+
+func TestDetectCodec(t *testing.T) {
+	tests := []struct {
+		req  string
+		want Codec
+	}{
+		{"/midi\x00\x00\x00,m\x00\x00\x00\x64\x3c\x90", legacyCodec{}},
+		{"/text 90 3c 64", textCodec{}},
+		{"/unknown", nil},
+	}
+	for _, tt := range tests {
+		if got := detectCodec([]byte(tt.req)); got != tt.want {
+			t.Errorf("%q: codec %v, want %v", tt.req, got, tt.want)
+		}
+	}
+}
+
+func TestFixedCodec(t *testing.T) {
+	quiet(t)
+
+	tests := []struct {
+		name  string
+		codec Codec
+		req   []byte
+		want  []byte
+		drops []string
+	}{
+		{
+			name: "auto detected",
+			req:  []byte("/text 90 3c 64\n/text 80 3c 00"),
+			want: []byte{0x90, 0x3c, 0x64, 0x80, 0x3c, 0x00},
+		},
+		{
+			name:  "fixed codec takes only its format",
+			codec: textCodec{},
+			req:   legacyPacket(0x90, 60, 100),
+			drops: []string{"unknown-command"},
+		},
+		{
+			name:  "fixed codec",
+			codec: textCodec{},
+			req:   []byte("/text 90 3c 64"),
+			want:  []byte{0x90, 0x3c, 0x64},
+		},
+		{
+			name:  "undecodable",
+			req:   []byte("/text 90 zz 64"),
+			drops: []string{"undecodable"},
+		},
+		{
+			name:  "legacy with a short payload",
+			req:   legacyPacket(0x90, 60, 100)[:12],
+			drops: []string{"undecodable"},
+		},
+		{
+			name:  "unknown",
+			req:   []byte("/unknown"),
+			drops: []string{"unknown-command"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m, out := testBridge(t, func(m *MidiBridge) { m.Codec = tt.codec })
+			d := recordDrops(m)
+
+			m.handleCmd(tt.req, nil)
+			m.Close()
+
+			if got := out.Bytes(); !bytes.Equal(got, tt.want) {
+				t.Errorf("wrote % X, want % X", got, tt.want)
+			}
+			if got := d.reasons(); !reflect.DeepEqual(got, tt.drops) {
+				t.Errorf("dropped for %q, want %q", got, tt.drops)
+			}
+		})
+	}
+}
@@ -0,0 +1,58 @@
+package main
+
+import "time"
+
+type ccValue struct {
+	Channel    byte
+	Controller byte
+	Value      byte
+}
+
+type ccSeen struct {
+	source string
+	at     time.Time
+}
+
+// ccCollapser drops a controller value that another source already sent
+// within window, so several controllers mapped to the same CC don't double
+// the traffic.
+type ccCollapser struct {
+	window time.Duration
+	seen   map[ccValue]ccSeen
+}
+
+func newCCCollapser(window time.Duration) *ccCollapser {
+	return &ccCollapser{window: window, seen: map[ccValue]ccSeen{}}
+}
+
+// duplicate reports whether msg from source repeats another source.
+func (c *ccCollapser) duplicate(msg Midi, source string) bool {
+	if msg.Command() != ContinuousContr {
+		return false
+	}
+
+	now := time.Now()
+	k := ccValue{msg.Channel, msg.Note, msg.Velocity}
+	if s, ok := c.seen[k]; ok && s.source != source && now.Sub(s.at) <= c.window {
+		return true
+	}
+	c.seen[k] = ccSeen{source, now}
+
+	// keep the map from growing with every value ever sent
+	if len(c.seen) > 1024 {
+		for k, s := range c.seen {
+			if now.Sub(s.at) > c.window {
+				delete(c.seen, k)
+			}
+		}
+	}
+
+	return false
+}
+
+func (m *MidiBridge) collapser() *ccCollapser {
+	if m.collapse == nil {
+		m.collapse = newCCCollapser(m.CollapseCC)
+	}
+	return m.collapse
+}
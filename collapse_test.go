@@ -0,0 +1,94 @@
+package main
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestCCCollapser(t *testing.T) {
+	const window = 30 * time.Millisecond
+
+	type step struct {
+		wait   time.Duration
+		source string
+		msg    Midi
+		dup    bool
+	}
+	tests := []struct {
+		name  string
+		steps []step
+	}{
+		{
+			name: "second source within the window",
+			steps: []step{
+				{0, "a", cc(0, 7, 100), false},
+				{0, "b", cc(0, 7, 100), true},
+			},
+		},
+		{
+			name: "same source repeating",
+			steps: []step{
+				{0, "a", cc(0, 7, 100), false},
+				{0, "a", cc(0, 7, 100), false},
+			},
+		},
+		{
+			name: "second source after the window",
+			steps: []step{
+				{0, "a", cc(0, 7, 100), false},
+				{2 * window, "b", cc(0, 7, 100), false},
+			},
+		},
+		{
+			name: "other value, controller or channel",
+			steps: []step{
+				{0, "a", cc(0, 7, 100), false},
+				{0, "b", cc(0, 7, 101), false},
+				{0, "b", cc(0, 10, 100), false},
+				{0, "b", cc(1, 7, 100), false},
+			},
+		},
+		{
+			name: "only controllers",
+			steps: []step{
+				{0, "a", noteOn(0, 60, 100), false},
+				{0, "b", noteOn(0, 60, 100), false},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := newCCCollapser(window)
+			for i, s := range tt.steps {
+				time.Sleep(s.wait)
+				if got := c.duplicate(s.msg, s.source); got != s.dup {
+					t.Errorf("step %d: duplicate %v, want %v", i, got, s.dup)
+				}
+			}
+		})
+	}
+}
+
+func TestCollapseCC(t *testing.T) {
+	quiet(t)
+
+	m, out := testBridge(t, func(m *MidiBridge) { m.CollapseCC = time.Second })
+	d := recordDrops(m)
+
+	m.handleCmd(legacyPacket(0xB0, 7, 100), udpAddr(1))
+	m.handleCmd(legacyPacket(0xB0, 7, 100), udpAddr(2))
+	m.handleCmd(legacyPacket(0xB0, 7, 100), udpAddr(1))
+	m.handleCmd(legacyPacket(0x90, 60, 100), udpAddr(2))
+	m.Close()
+
+	want := []byte{0xB0, 7, 100, 0xB0, 7, 100, 0x90, 60, 100}
+	if got := out.Bytes(); !bytes.Equal(got, want) {
+		t.Errorf("wrote % X, want % X", got, want)
+	}
+	if got := d.reasons(); !reflect.DeepEqual(got, []string{"duplicate-cc"}) {
+		t.Errorf("dropped for %q", got)
+	}
+}
@@ -0,0 +1,88 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+)
+
+// validateFlags checks the resolved flags and returns one error per
+// offending flag.
+func validateFlags() []error {
+	var errs []error
+
+	if *midiInDev == "" && *midiOutDev == "" {
+		errs = append(errs, fmt.Errorf("no midi device given, use -midi, -midi-in or -midi-out"))
+	}
+
+	errs = append(errs, pipelineConfig.validate()...)
+
+	if *notesPriority < 0 {
+		errs = append(errs, fmt.Errorf("-notes-priority: queue depth %d is negative", *notesPriority))
+	}
+	if *thin < 0 {
+		errs = append(errs, fmt.Errorf("-thin: queue depth %d is negative", *thin))
+	}
+
+	if *maxAge < 0 {
+		errs = append(errs, fmt.Errorf("-max-age: %s is negative", *maxAge))
+	}
+
+	if *collapseCC < 0 {
+		errs = append(errs, fmt.Errorf("-collapse-cc: %s is negative", *collapseCC))
+	}
+
+	if *thruDelay < 0 {
+		errs = append(errs, fmt.Errorf("-thru-delay: %s is negative", *thruDelay))
+	}
+
+	if *reorderWindow < 0 {
+		errs = append(errs, fmt.Errorf("-reorder-window: %s is negative", *reorderWindow))
+	}
+
+	if *channelGap < 0 {
+		errs = append(errs, fmt.Errorf("-channel-gap: %s is negative", *channelGap))
+	}
+
+	if *sweepPeriod <= 0 {
+		errs = append(errs, fmt.Errorf("-sweep-period: %s is not positive", *sweepPeriod))
+	}
+
+	if *grace < 0 {
+		errs = append(errs, fmt.Errorf("-grace: %s is negative", *grace))
+	}
+
+	if *activeChannel < -1 || *activeChannel > 15 {
+		errs = append(errs, fmt.Errorf("-channel: %d out of range [0-15]", *activeChannel))
+	}
+	if *channelCC < -1 || *channelCC > 127 {
+		errs = append(errs, fmt.Errorf("-channel-cc: controller %d out of range [0-127]", *channelCC))
+	}
+
+	if *scriptPath != "" {
+		if _, err := loadScript(*scriptPath); err != nil {
+			errs = append(errs, fmt.Errorf("-script: %v", err))
+		}
+	}
+
+	if *pprofAddr != "" {
+		if err := checkLoopback(*pprofAddr); err != nil {
+			errs = append(errs, fmt.Errorf("-pprof: %v", err))
+		}
+	}
+
+	if *stateResend && *statePath == "" {
+		errs = append(errs, fmt.Errorf("-state-resend: needs -state"))
+	}
+
+	if _, ok := codecs[*codecName]; *codecName != "" && !ok {
+		errs = append(errs, fmt.Errorf("-codec: unknown codec %q", *codecName))
+	}
+
+	return errs
+}
+
+func printFlags() {
+	flag.VisitAll(func(f *flag.Flag) {
+		fmt.Printf("-%s=%s\n", f.Name, f.Value)
+	})
+}
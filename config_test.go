@@ -0,0 +1,145 @@
+package main
+
+import (
+	"flag"
+	"io"
+	"os"
+	"strings"
+	"testing"
+)
+
+// setFlags sets command line flags for the test and puts the old values
+// back after it.
+func setFlags(t *testing.T, values map[string]string) {
+	t.Helper()
+
+	for name, v := range values {
+		f := flag.Lookup(name)
+		if f == nil {
+			t.Fatalf("no flag -%s", name)
+		}
+		old := f.Value.String()
+		if err := f.Value.Set(v); err != nil {
+			t.Fatalf("-%s=%s: %v", name, v, err)
+		}
+		t.Cleanup(func() { f.Value.Set(old) })
+	}
+}
+
+// captureStdout returns what f prints.
+func captureStdout(t *testing.T, f func()) string {
+	t.Helper()
+
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	stdout := os.Stdout
+	os.Stdout = w
+	defer func() { os.Stdout = stdout }()
+
+	done := make(chan string)
+	go func() {
+		b, _ := io.ReadAll(r)
+		done <- string(b)
+	}()
+	f()
+	w.Close()
+	return <-done
+}
+
+func TestValidateFlags(t *testing.T) {
+	tests := []struct {
+		name  string
+		flags map[string]string
+		// want are the flags complained about, in order
+		want []string
+	}{
+		{
+			name:  "valid",
+			flags: map[string]string{"midi-out": "/dev/null"},
+		},
+		{
+			name: "no device",
+			want: []string{"no midi device"},
+		},
+		{
+			name: "every error is reported",
+			flags: map[string]string{
+				"midi-in":      "/dev/null",
+				"thin":         "-1",
+				"max-age":      "-1s",
+				"channel":      "16",
+				"gate-cc":      "128",
+				"codec":        "nope",
+				"grace":        "-1ms",
+				"pprof":        "0.0.0.0:6060",
+				"state-resend": "true",
+			},
+			want: []string{"-gate-cc", "-thin", "-max-age", "-grace", "-channel", "-pprof", "-state-resend", "-codec"},
+		},
+		{
+			name:  "channel remapping off",
+			flags: map[string]string{"midi-out": "/dev/null", "channel": "-1", "channel-cc": "-1"},
+		},
+		{
+			name:  "zero sweep period",
+			flags: map[string]string{"midi-out": "/dev/null", "sweep-period": "0s"},
+			want:  []string{"-sweep-period"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			setFlags(t, tt.flags)
+
+			errs := validateFlags()
+			if len(errs) != len(tt.want) {
+				t.Fatalf("got errors %v, want %d", errs, len(tt.want))
+			}
+			for i, err := range errs {
+				if !strings.HasPrefix(err.Error(), tt.want[i]) {
+					t.Errorf("error %d is %q, want it about %s", i, err, tt.want[i])
+				}
+			}
+		})
+	}
+}
+
+func TestPipelineFlagsValidate(t *testing.T) {
+	tests := []struct {
+		args []string
+		want int
+	}{
+		{nil, 0},
+		{[]string{"-cc-to-pitchbend", "1", "-pitchbend-to-cc", "127"}, 0},
+		{[]string{"-cc-to-pitchbend", "-2"}, 1},
+		{[]string{"-bend-center", "0"}, 1},
+		{[]string{"-bend-center", "8000"}, 0},
+		{[]string{"-transpose-range", "128", "-normalize", "200"}, 2},
+		{[]string{"-normalize-rate", "0"}, 1},
+		{[]string{"-soft-pedal", "-0.5"}, 1},
+	}
+
+	for _, tt := range tests {
+		fs := flag.NewFlagSet("test", flag.ContinueOnError)
+		p := newPipelineFlags(fs)
+		if err := fs.Parse(tt.args); err != nil {
+			t.Fatal(err)
+		}
+		if errs := p.validate(); len(errs) != tt.want {
+			t.Errorf("%v: got errors %v, want %d", tt.args, errs, tt.want)
+		}
+	}
+}
+
+func TestPrintFlags(t *testing.T) {
+	setFlags(t, map[string]string{"midi-out": "/dev/null", "thin": "8"})
+
+	out := captureStdout(t, printFlags)
+	for _, want := range []string{"-midi-out=/dev/null\n", "-thin=8\n", "-echo=false\n", "-check-config=false\n"} {
+		if !strings.Contains(out, want) {
+			t.Errorf("printed flags lack %q", want)
+		}
+	}
+}
@@ -0,0 +1,90 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+const udpScheme = "udp://"
+
+// deadLetters records dropped messages with the reason they were dropped,
+// one line each, to a file or to a UDP address. A file is rotated to
+// path.1 once it grows past max bytes.
+type deadLetters struct {
+	mu   sync.Mutex
+	path string
+	w    io.WriteCloser
+	size int64
+	max  int64
+}
+
+func openDeadLetters(target string, max int64) (*deadLetters, error) {
+	if strings.HasPrefix(target, udpScheme) {
+		conn, err := net.Dial(udp, strings.TrimPrefix(target, udpScheme))
+		if err != nil {
+			return nil, err
+		}
+		return &deadLetters{w: conn}, nil
+	}
+
+	d := &deadLetters{path: target, max: max}
+	if err := d.open(); err != nil {
+		return nil, err
+	}
+	return d, nil
+}
+
+func (d *deadLetters) open() error {
+	f, err := os.OpenFile(d.path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0644)
+	if err != nil {
+		return err
+	}
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return err
+	}
+	d.w, d.size = f, info.Size()
+	return nil
+}
+
+func (d *deadLetters) rotate() error {
+	d.w.Close()
+	if err := os.Rename(d.path, d.path+".1"); err != nil {
+		return err
+	}
+	return d.open()
+}
+
+func (d *deadLetters) record(reason string, data []byte) {
+	line := fmt.Sprintf("%s %s % X\n", time.Now().Format(time.RFC3339Nano), reason, data)
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if d.path != "" && d.max > 0 && d.size+int64(len(line)) > d.max {
+		if err := d.rotate(); err != nil {
+			log.Println(err)
+			return
+		}
+	}
+
+	n, err := io.WriteString(d.w, line)
+	d.size += int64(n)
+	if err != nil {
+		log.Println(err)
+	}
+}
+
+// drop records data in the dead letter sink, if there is one.
+func (m *MidiBridge) drop(reason string, data []byte) {
+	if m.DeadLetters != nil {
+		m.DeadLetters.record(reason, data)
+	}
+}
@@ -0,0 +1,196 @@
+package main
+
+import (
+	"errors"
+	"net"
+	"os"
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+)
+
+var deadLetterLine = regexp.MustCompile(`^\S+ (\S+) ([0-9A-F ]+)$`)
+
+func TestDeadLetterFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "dropped")
+
+	d, err := openDeadLetters(path, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	d.record("stale", []byte{0xB0, 7, 100})
+	d.w.Close()
+
+	// reopening appends
+	d, err = openDeadLetters(path, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	d.record("thinned", []byte{0xE0, 0, 64})
+	d.w.Close()
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(strings.TrimSuffix(string(data), "\n"), "\n")
+	want := [][2]string{{"stale", "B0 07 64"}, {"thinned", "E0 00 40"}}
+	if len(lines) != len(want) {
+		t.Fatalf("recorded %q, want %d lines", lines, len(want))
+	}
+	for i, line := range lines {
+		m := deadLetterLine.FindStringSubmatch(line)
+		if m == nil || m[1] != want[i][0] || m[2] != want[i][1] {
+			t.Errorf("line %q, want reason %s and %s", line, want[i][0], want[i][1])
+			continue
+		}
+		if _, err := time.Parse(time.RFC3339Nano, strings.Fields(line)[0]); err != nil {
+			t.Errorf("line %q: %v", line, err)
+		}
+	}
+}
+
+func TestDeadLetterRotation(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "dropped")
+
+	d, err := openDeadLetters(path, 100)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { d.w.Close() }()
+
+	for i := 0; i < 5; i++ {
+		d.record("stale", []byte{0x90, byte(i), 100})
+	}
+
+	for _, p := range []string{path, path + ".1"} {
+		info, err := os.Stat(p)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if info.Size() == 0 || info.Size() > 100 {
+			t.Errorf("%s is %d bytes, want at most 100", p, info.Size())
+		}
+	}
+	data, _ := os.ReadFile(path)
+	if !strings.HasSuffix(string(data), "stale 90 04 64\n") {
+		t.Errorf("%s doesn't end with the last message: %q", path, data)
+	}
+}
+
+func TestDeadLetterUDP(t *testing.T) {
+	conn, err := net.ListenPacket(udp, "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	d, err := openDeadLetters(udpScheme+conn.LocalAddr().String(), 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer d.w.Close()
+	d.record("duplicate-cc", []byte{0xB0, 7, 100})
+
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	buf := make([]byte, 256)
+	n, _, err := conn.ReadFrom(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasSuffix(string(buf[:n]), " duplicate-cc B0 07 64\n") {
+		t.Errorf("received %q", buf[:n])
+	}
+}
+
+// failingOut fails every write.
+type failingOut struct{}
+
+func (failingOut) Write(p []byte) (int, error) { return 0, errors.New("device gone") }
+
+func TestDropReasons(t *testing.T) {
+	quiet(t)
+
+	m := NewMidiBridge(nil, failingOut{})
+	d := recordDrops(m)
+	m.DropStrayOffs = true
+
+	m.Write([]byte{0x80, 60, 0})
+	m.Write([]byte{0x90, 60, 100})
+	m.handleCmd([]byte("/nothing"), nil)
+	m.Close()
+
+	// the write error comes from the writer, any time after the note on
+	got := d.reasons()
+	sort.Strings(got)
+	if want := []string{"stray-note-off", "unknown-command", "write-error"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("dropped for %q, want %q", got, want)
+	}
+}
+
+func TestFilteredDeadLetters(t *testing.T) {
+	quiet(t)
+
+	tests := []struct {
+		name  string
+		setup func(m *MidiBridge)
+		req   []byte
+		want  string
+	}{
+		{
+			name:  "gate",
+			setup: func(m *MidiBridge) { m.Use(Gate(65)); m.handleCmd(legacyPacket(0xB0, 65, 127), nil) },
+			req:   legacyPacket(0x90, 60, 100),
+			want:  "filtered 90 3C 64",
+		},
+		{
+			name:  "transpose out of range",
+			setup: func(m *MidiBridge) { m.Use(Transpose(20, 24, false)); m.handleCmd(legacyPacket(0xB0, 20, 127), nil) },
+			req:   legacyPacket(0x90, 120, 100),
+			want:  "filtered 90 78 64",
+		},
+		{
+			name: "script",
+			setup: func(m *MidiBridge) {
+				m.Script, _ = parseScript("type=cc cc=7 drop")
+			},
+			req:  legacyPacket(0xB0, 7, 90),
+			want: "filtered B0 07 5A",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m, out := testBridge(t, nil)
+			tt.setup(m)
+			// only what the request drops
+			d := recordDrops(m)
+
+			m.handleCmd(tt.req, nil)
+			m.Close()
+
+			if got := out.Bytes(); len(got) != 0 {
+				t.Errorf("wrote % X", got)
+			}
+			lines := strings.Split(strings.TrimSpace(string(d.Bytes())), "\n")
+			if len(lines) != 1 || !strings.HasSuffix(lines[0], " "+tt.want) {
+				t.Errorf("dead letters %q, want one %q", lines, tt.want)
+			}
+		})
+	}
+}
+
+func TestNoMidiOutDeadLetters(t *testing.T) {
+	m := NewMidiBridge(nil, nil)
+	d := recordDrops(m)
+	m.Write([]byte{0x90, 60, 100})
+	m.Close()
+
+	if got := d.reasons(); !reflect.DeepEqual(got, []string{"no-midi-out"}) {
+		t.Errorf("dropped for %q", got)
+	}
+}
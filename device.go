@@ -0,0 +1,197 @@
+package main
+
+import (
+	"errors"
+	"io"
+	"log"
+	"net"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+const tcpScheme = "tcp://"
+
+func isTCPDevice(path string) bool {
+	return strings.HasPrefix(path, tcpScheme)
+}
+
+// openDevice opens a midi device file, or dials a serial to TCP server
+// (ser2net and alike) for paths of the form tcp://host:port.
+func openDevice(path string, flag int) (io.ReadWriteCloser, error) {
+	if isTCPDevice(path) {
+		d, err := dialDevice(strings.TrimPrefix(path, tcpScheme))
+		if err != nil {
+			// a nil *tcpDevice would be a non nil io.ReadWriteCloser
+			return nil, err
+		}
+		return d, nil
+	}
+
+	f, err := os.OpenFile(path, flag, 0666)
+	if err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+const (
+	// dialTimeout bounds every dial, the kernel default is minutes
+	dialTimeout = 5 * time.Second
+	redialDelay = time.Second
+)
+
+var errDisconnected = errors.New("disconnected, reconnecting")
+
+// tcpDevice is the byte stream of a remote serial port. A dropped
+// connection is dialed again in the background, reads block until it is
+// back while writes fail until then.
+type tcpDevice struct {
+	addr string
+
+	mu sync.Mutex
+	// changed is signalled when the connection is back or the device is
+	// closed
+	changed *sync.Cond
+	conn    net.Conn
+	closed  bool
+
+	// notify is called when the connection drops and when it is back
+	notify func(connected bool)
+}
+
+func dialDevice(addr string) (*tcpDevice, error) {
+	conn, err := net.DialTimeout("tcp", addr, dialTimeout)
+	if err != nil {
+		return nil, err
+	}
+	d := &tcpDevice{addr: addr, conn: conn}
+	d.changed = sync.NewCond(&d.mu)
+	return d, nil
+}
+
+// current returns the connection, errDisconnected while it is down.
+func (d *tcpDevice) current() (net.Conn, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if d.closed {
+		return nil, net.ErrClosed
+	}
+	if d.conn == nil {
+		return nil, errDisconnected
+	}
+	return d.conn, nil
+}
+
+// drop closes conn after err and starts dialing again, unless conn was
+// dropped already.
+func (d *tcpDevice) drop(conn net.Conn, err error) {
+	d.mu.Lock()
+	if d.conn != conn {
+		d.mu.Unlock()
+		return
+	}
+	conn.Close()
+	d.conn = nil
+	if d.closed {
+		d.mu.Unlock()
+		return
+	}
+	notify := d.notify
+	d.mu.Unlock()
+
+	log.Printf("%s: %v, reconnecting", d.addr, err)
+	if notify != nil {
+		notify(false)
+	}
+	go d.redial()
+}
+
+// redial dials until the connection is back or the device is closed, the
+// lock is not held while dialing.
+func (d *tcpDevice) redial() {
+	for {
+		conn, err := net.DialTimeout("tcp", d.addr, dialTimeout)
+
+		d.mu.Lock()
+		if d.closed {
+			d.mu.Unlock()
+			if err == nil {
+				conn.Close()
+			}
+			return
+		}
+		if err != nil {
+			d.mu.Unlock()
+			time.Sleep(redialDelay)
+			continue
+		}
+		d.conn = conn
+		d.changed.Broadcast()
+		notify := d.notify
+		d.mu.Unlock()
+
+		log.Printf("%s: reconnected", d.addr)
+		if notify != nil {
+			notify(true)
+		}
+		return
+	}
+}
+
+func (d *tcpDevice) Read(p []byte) (int, error) {
+	for {
+		d.mu.Lock()
+		for d.conn == nil && !d.closed {
+			d.changed.Wait()
+		}
+		conn, closed := d.conn, d.closed
+		d.mu.Unlock()
+
+		if closed {
+			return 0, net.ErrClosed
+		}
+		n, err := conn.Read(p)
+		if n > 0 || err == nil {
+			return n, nil
+		}
+		d.drop(conn, err)
+	}
+}
+
+func (d *tcpDevice) Write(p []byte) (int, error) {
+	conn, err := d.current()
+	if err != nil {
+		return 0, err
+	}
+
+	n, err := conn.Write(p)
+	if err != nil {
+		d.drop(conn, err)
+	}
+	return n, err
+}
+
+func (d *tcpDevice) setNotify(notify func(connected bool)) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	d.notify = notify
+}
+
+func (d *tcpDevice) Close() error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if d.closed {
+		return nil
+	}
+	d.closed = true
+	d.changed.Broadcast()
+	if d.conn == nil {
+		return nil
+	}
+	return d.conn.Close()
+}
@@ -0,0 +1,221 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"net"
+	"os"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// serialServer stands in for a ser2net port, it hands out every
+// connection it accepts.
+func serialServer(t *testing.T) (net.Listener, chan net.Conn) {
+	t.Helper()
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { ln.Close() })
+
+	conns := make(chan net.Conn, 4)
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			conns <- conn
+		}
+	}()
+	return ln, conns
+}
+
+func accept(t *testing.T, conns chan net.Conn) net.Conn {
+	t.Helper()
+
+	select {
+	case conn := <-conns:
+		t.Cleanup(func() { conn.Close() })
+		return conn
+	case <-time.After(5 * time.Second):
+		t.Fatal("no connection")
+	}
+	return nil
+}
+
+func TestTCPDeviceReadWrite(t *testing.T) {
+	ln, conns := serialServer(t)
+
+	dev, err := openDevice(tcpScheme+ln.Addr().String(), os.O_RDWR)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer dev.Close()
+	server := accept(t, conns)
+
+	note := []byte{0x90, 60, 100}
+	if _, err := dev.Write(note); err != nil {
+		t.Fatal(err)
+	}
+	got := make([]byte, 3)
+	if _, err := io.ReadFull(server, got); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, note) {
+		t.Errorf("server read % X, want % X", got, note)
+	}
+
+	clock := []byte{0xF8}
+	server.Write(clock)
+	got = make([]byte, 1)
+	if _, err := io.ReadFull(dev, got); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, clock) {
+		t.Errorf("device read % X, want % X", got, clock)
+	}
+}
+
+func TestTCPDeviceReconnects(t *testing.T) {
+	ln, conns := serialServer(t)
+
+	dev, err := openDevice(tcpScheme+ln.Addr().String(), os.O_RDWR)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer dev.Close()
+
+	notified := make(chan bool, 2)
+	dev.(*tcpDevice).setNotify(func(connected bool) { notified <- connected })
+
+	read := make(chan byte)
+	go func() {
+		b := make([]byte, 1)
+		if _, err := io.ReadFull(dev, b); err == nil {
+			read <- b[0]
+		}
+	}()
+
+	// the reader notices the drop and dials again
+	accept(t, conns).Close()
+	server := accept(t, conns)
+	server.Write([]byte{0xFA})
+
+	select {
+	case b := <-read:
+		if b != 0xFA {
+			t.Errorf("read %02X after reconnect, want FA", b)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("nothing read after reconnect")
+	}
+
+	for _, want := range []bool{false, true} {
+		select {
+		case got := <-notified:
+			if got != want {
+				t.Errorf("notified connected=%v, want %v", got, want)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("no notification connected=%v", want)
+		}
+	}
+}
+
+func TestOpenDeviceUnreachable(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := ln.Addr().String()
+	ln.Close()
+
+	dev, err := openDevice(tcpScheme+addr, os.O_RDWR)
+	if err == nil {
+		t.Fatal("no error dialing a closed port")
+	}
+	if dev != nil {
+		t.Errorf("device is %#v, want nil so -degraded sees it missing", dev)
+	}
+}
+
+func TestDeviceNotify(t *testing.T) {
+	ln, conns := serialServer(t)
+	path := tcpScheme + ln.Addr().String()
+
+	dev, err := openDevice(path, os.O_RDWR)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer dev.Close()
+
+	conn := &packetConn{}
+	m, _ := testBridge(t, func(m *MidiBridge) {
+		m.NotifyConn = conn
+		m.Notify = udpAddr(9)
+	})
+	dev.(*tcpDevice).setNotify(m.notifyDevice(path))
+
+	go io.ReadFull(dev, make([]byte, 1))
+	accept(t, conns).Close()
+	accept(t, conns).Write([]byte{0xFA})
+
+	want := []sentPacket{
+		{oscMessage(disconnectedReply, path), udpAddr(9).String()},
+		{oscMessage(connectedReply, path), udpAddr(9).String()},
+	}
+	deadline := time.Now().Add(5 * time.Second)
+	for !reflect.DeepEqual(conn.packets(), want) {
+		if time.Now().After(deadline) {
+			t.Fatalf("notified %q\nwant     %q", conn.packets(), want)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestNotifyUnset(t *testing.T) {
+	conn := &packetConn{}
+	m, _ := testBridge(t, func(m *MidiBridge) { m.NotifyConn = conn })
+
+	m.notifyDevice("tcp://127.0.0.1:1")(false)
+	if sent := conn.packets(); len(sent) != 0 {
+		t.Errorf("notified %q without -notify", sent)
+	}
+}
+
+func TestTCPDeviceWriteFailsWhileDown(t *testing.T) {
+	ln, conns := serialServer(t)
+
+	dev, err := openDevice(tcpScheme+ln.Addr().String(), os.O_RDWR)
+	if err != nil {
+		t.Fatal(err)
+	}
+	d := dev.(*tcpDevice)
+	accept(t, conns)
+
+	// nothing answers the redial
+	ln.Close()
+	conn, _ := d.current()
+	d.drop(conn, io.EOF)
+
+	start := time.Now()
+	if _, err := dev.Write([]byte{0x90, 60, 100}); !errors.Is(err, errDisconnected) {
+		t.Errorf("write while down: %v, want %v", err, errDisconnected)
+	}
+	d.setNotify(nil)
+	if err := dev.Close(); err != nil {
+		t.Error(err)
+	}
+	if took := time.Since(start); took > time.Second {
+		t.Errorf("write, setNotify and Close took %v while redialing", took)
+	}
+
+	if _, err := dev.Read(make([]byte, 1)); !errors.Is(err, net.ErrClosed) {
+		t.Errorf("read after close: %v", err)
+	}
+}
@@ -0,0 +1,45 @@
+package main
+
+// Gate mutes everything while controller cc, typically a footswitch, is
+// down. Notes sounding when it goes down are released, notes played while
+// it is down are not started at all. The controller is not forwarded.
+func Gate(cc byte) Transform {
+	muted := false
+	playing := map[noteKey]bool{}
+
+	return func(msg Midi) []Midi {
+		switch {
+		case msg.isCC(cc):
+			down := pedalDown(msg)
+			if down == muted {
+				return nil
+			}
+			muted = down
+
+			if !muted {
+				return nil
+			}
+			var out []Midi
+			for k := range playing {
+				out = append(out, Midi{State: NoteOff >> 4, Channel: k.Channel, Note: k.Note})
+				delete(playing, k)
+			}
+			return out
+
+		case muted:
+			return nil
+
+		case msg.isNoteOn():
+			playing[msg.key()] = true
+
+		case msg.isNoteOff():
+			if !playing[msg.key()] {
+				// released when the gate closed
+				return nil
+			}
+			delete(playing, msg.key())
+		}
+
+		return []Midi{msg}
+	}
+}
@@ -0,0 +1,55 @@
+package main
+
+import "testing"
+
+func TestGate(t *testing.T) {
+	tests := []struct {
+		name  string
+		steps []transformStep
+	}{
+		{
+			name: "down releases sounding notes",
+			steps: []transformStep{
+				{noteOn(0, 60, 100), []Midi{noteOn(0, 60, 100)}},
+				{cc(0, 65, 127), []Midi{noteOff(0, 60)}},
+				{noteOff(0, 60), nil},
+				{cc(0, 65, 0), nil},
+				{noteOff(0, 60), nil},
+			},
+		},
+		{
+			name: "everything is muted while down",
+			steps: []transformStep{
+				{cc(0, 65, 127), nil},
+				{noteOn(0, 60, 100), nil},
+				{cc(0, 7, 90), nil},
+				{noteOff(0, 60), nil},
+				{cc(0, 65, 0), nil},
+				{noteOn(0, 62, 100), []Midi{noteOn(0, 62, 100)}},
+				{noteOff(0, 62), []Midi{noteOff(0, 62)}},
+			},
+		},
+		{
+			name: "repeated positions are swallowed",
+			steps: []transformStep{
+				{cc(0, 65, 0), nil},
+				{noteOn(0, 60, 100), []Midi{noteOn(0, 60, 100)}},
+				{cc(0, 65, 127), []Midi{noteOff(0, 60)}},
+				{cc(0, 65, 100), nil},
+			},
+		},
+		{
+			name: "other messages pass while up",
+			steps: []transformStep{
+				{cc(0, 7, 90), []Midi{cc(0, 7, 90)}},
+				{noteOff(0, 60), nil},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			runSteps(t, Gate(65), tt.steps)
+		})
+	}
+}
@@ -0,0 +1,69 @@
+package main
+
+import "fmt"
+
+// dataBytes is the number of data bytes following a status byte, -1 for
+// status bytes that never start a message of their own.
+func dataBytes(status byte) int {
+	switch {
+	case status < SysExC:
+		switch status & 0xf0 {
+		case PatchChange, ChannelPressure:
+			return 1
+		}
+		return 2
+	case status == 0xF1, status == 0xF3:
+		return 1
+	case status == 0xF2:
+		return 2
+	case status == 0xF6, status >= 0xF8:
+		return 0
+	}
+	return -1
+}
+
+// validMessage checks that data is exactly one well formed message, a
+// status byte followed by the right number of data bytes. A malformed
+// message would desync the device until the next status byte.
+func validMessage(data []byte) error {
+	if len(data) == 0 {
+		return fmt.Errorf("empty message")
+	}
+	if data[0]&0x80 == 0 {
+		return fmt.Errorf("message starts with data byte %02X", data[0])
+	}
+
+	body := data[1:]
+	if data[0] == SysExC {
+		if data[len(data)-1] != SysExEnd {
+			return fmt.Errorf("sysex not terminated")
+		}
+		body = data[1 : len(data)-1]
+	} else if n := dataBytes(data[0]); n != len(body) {
+		return fmt.Errorf("status %02X takes %d data bytes, got %d", data[0], n, len(body))
+	}
+
+	for _, b := range body {
+		if b&0x80 != 0 {
+			return fmt.Errorf("status byte %02X in data of %02X", b, data[0])
+		}
+	}
+
+	return nil
+}
+
+// validMessages checks data holding one message, or several channel
+// messages back to back as written for an NRPN edit.
+func validMessages(data []byte) error {
+	for len(data) > 0 && data[0] < SysExC {
+		n := 1 + dataBytes(data[0])
+		if len(data) <= n {
+			break
+		}
+		if err := validMessage(data[:n]); err != nil {
+			return err
+		}
+		data = data[n:]
+	}
+	return validMessage(data)
+}
@@ -0,0 +1,73 @@
+package main
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestMidiBytes(t *testing.T) {
+	tests := []struct {
+		msg  Midi
+		want []byte
+	}{
+		{noteOn(1, 60, 100), []byte{0x91, 60, 100}},
+		{cc(0, 7, 90), []byte{0xB0, 7, 90}},
+		{Midi{State: PatchChange >> 4, Channel: 2, Note: 5, Velocity: 9}, []byte{0xC2, 5}},
+		{Midi{State: ChannelPressure >> 4, Note: 64, Velocity: 9}, []byte{0xD0, 64}},
+		{Midi{State: 0xF, Channel: 0x8, Note: 1, Velocity: 2}, []byte{0xF8}},
+		{Midi{State: 0xF, Channel: 0xA, Note: 1, Velocity: 2}, []byte{0xFA}},
+		{Midi{State: 0xF, Channel: 0xC}, []byte{0xFC}},
+		{Midi{State: 0xF, Channel: 0x6}, []byte{0xF6}},
+		{Midi{State: 0xF, Channel: 0x1, Note: 0x23, Velocity: 2}, []byte{0xF1, 0x23}},
+		{Midi{State: 0xF, Channel: 0x3, Note: 4, Velocity: 2}, []byte{0xF3, 4}},
+		{Midi{State: 0xF, Channel: 0x2, Note: 1, Velocity: 2}, []byte{0xF2, 1, 2}},
+	}
+	for _, tt := range tests {
+		if got := tt.msg.Bytes(); !bytes.Equal(got, tt.want) {
+			t.Errorf("%+v: % X, want % X", tt.msg, got, tt.want)
+		}
+	}
+}
+
+func TestValidMessages(t *testing.T) {
+	tests := []struct {
+		name string
+		data []byte
+		ok   bool
+	}{
+		{"note on", []byte{0x90, 60, 100}, true},
+		{"program change", []byte{0xC0, 5}, true},
+		{"clock", []byte{0xF8}, true},
+		{"song position", []byte{0xF2, 1, 2}, true},
+		{"sysex", []byte{0xF0, 0x7E, 0x7F, 0x06, 0x01, 0xF7}, true},
+		{"nrpn edit", []byte{0xB0, 99, 1, 0xB0, 98, 2, 0xB0, 6, 64}, true},
+		{"empty", nil, false},
+		{"data byte first", []byte{60, 100}, false},
+		{"short note", []byte{0x90, 60}, false},
+		{"long program change", []byte{0xC0, 5, 0}, false},
+		{"clock with data", []byte{0xF8, 0, 0}, false},
+		{"status in data", []byte{0x90, 0x90, 100}, false},
+		{"unterminated sysex", []byte{0xF0, 0x7E, 0x7F}, false},
+		{"torn nrpn edit", []byte{0xB0, 99, 1, 0xB0, 98}, false},
+		{"end of sysex alone", []byte{0xF7}, false},
+	}
+	for _, tt := range tests {
+		if err := validMessages(tt.data); (err == nil) != tt.ok {
+			t.Errorf("%s: % X error %v, want ok %v", tt.name, tt.data, err, tt.ok)
+		}
+	}
+}
+
+func TestGuardPassesRealTime(t *testing.T) {
+	quiet(t)
+
+	m, out := testBridge(t, func(m *MidiBridge) { m.Guard = true })
+	for _, status := range []byte{0xFA, 0xF8, 0xFC} {
+		m.handleCmd(legacyPacket(status, 0, 0), nil)
+	}
+	m.Close()
+
+	if got, want := out.Bytes(), []byte{0xFA, 0xF8, 0xFC}; !bytes.Equal(got, want) {
+		t.Errorf("wrote % X, want % X", got, want)
+	}
+}
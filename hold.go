@@ -0,0 +1,32 @@
+package main
+
+// hold freezes everything played for ambient drones. While on, note offs
+// are held back, release sends all of them, one per note on, keeping their
+// release velocity.
+type hold struct {
+	on   bool
+	offs map[noteKey][]Midi
+}
+
+func newHold() *hold {
+	return &hold{offs: map[noteKey][]Midi{}}
+}
+
+func (h *hold) transform(msg Midi) []Midi {
+	if h.on && msg.isNoteOff() {
+		h.offs[msg.key()] = append(h.offs[msg.key()], msg)
+		return nil
+	}
+	return []Midi{msg}
+}
+
+func (h *hold) release() []Midi {
+	h.on = false
+
+	var out []Midi
+	for k, offs := range h.offs {
+		out = append(out, offs...)
+		delete(h.offs, k)
+	}
+	return out
+}
@@ -0,0 +1,80 @@
+package main
+
+import (
+	"bytes"
+	"reflect"
+	"sort"
+	"testing"
+)
+
+func TestHold(t *testing.T) {
+	tests := []struct {
+		name    string
+		steps   []transformStep
+		release []Midi
+	}{
+		{
+			name: "note offs are held until release",
+			steps: []transformStep{
+				{noteOn(0, 60, 100), []Midi{noteOn(0, 60, 100)}},
+				{noteOff(0, 60), nil},
+				{noteOn(0, 60, 0), nil},
+				{cc(0, 7, 90), []Midi{cc(0, 7, 90)}},
+			},
+			release: []Midi{noteOff(0, 60), noteOn(0, 60, 0)},
+		},
+		{
+			name: "restruck notes get an off each",
+			steps: []transformStep{
+				{noteOn(0, 60, 100), []Midi{noteOn(0, 60, 100)}},
+				{noteOff(0, 60), nil},
+				{noteOn(0, 60, 100), []Midi{noteOn(0, 60, 100)}},
+				{Midi{State: NoteOff >> 4, Note: 60, Velocity: 30}, nil},
+				{noteOn(1, 60, 100), []Midi{noteOn(1, 60, 100)}},
+				{noteOff(1, 60), nil},
+			},
+			release: []Midi{noteOff(0, 60), {State: NoteOff >> 4, Note: 60, Velocity: 30}, noteOff(1, 60)},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := newHold()
+			h.on = true
+			runSteps(t, h.transform, tt.steps)
+
+			got := h.release()
+			// keys come out in any order, the offs of a key in order
+			sort.SliceStable(got, func(i, j int) bool { return got[i].Channel < got[j].Channel })
+			if !reflect.DeepEqual(got, tt.release) {
+				t.Errorf("released %+v, want %+v", got, tt.release)
+			}
+			if h.on || len(h.release()) != 0 {
+				t.Error("still holding after release")
+			}
+			runSteps(t, h.transform, []transformStep{{noteOff(0, 60), []Midi{noteOff(0, 60)}}})
+		})
+	}
+}
+
+func TestHoldCommands(t *testing.T) {
+	quiet(t)
+
+	m, out := testBridge(t, nil)
+	for _, req := range [][]byte{
+		[]byte(holdCall),
+		legacyPacket(0x90, 60, 100),
+		legacyPacket(0x80, 60, 0),
+		legacyPacket(0x90, 62, 100),
+		[]byte(releaseCall),
+		legacyPacket(0x80, 62, 0),
+	} {
+		m.handleCmd(req, nil)
+	}
+	m.Close()
+
+	want := []byte{0x90, 60, 100, 0x90, 62, 100, 0x80, 60, 0, 0x80, 62, 0}
+	if got := out.Bytes(); !bytes.Equal(got, want) {
+		t.Errorf("wrote % X, want % X", got, want)
+	}
+}
@@ -0,0 +1,137 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+type macroEvent struct {
+	at  time.Duration
+	msg Midi
+}
+
+// macros records what the bridge writes under a name and plays it back
+// with the original timing.
+type macros struct {
+	mu        sync.Mutex
+	recording string
+	started   time.Time
+	events    []macroEvent
+	stored    map[string][]macroEvent
+}
+
+func newMacros() *macros {
+	return &macros{stored: map[string][]macroEvent{}}
+}
+
+func (r *macros) record(msg Midi) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.recording == "" {
+		return
+	}
+	if r.events == nil {
+		// the macro starts with its first message, not with /record
+		r.started = time.Now()
+	}
+	r.events = append(r.events, macroEvent{time.Since(r.started), msg})
+}
+
+func (r *macros) start(name string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.recording = name
+	r.events = nil
+}
+
+func (r *macros) stop() (string, int) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	name, n := r.recording, len(r.events)
+	if name != "" {
+		r.stored[name] = r.events
+	}
+	r.recording = ""
+	r.events = nil
+
+	return name, n
+}
+
+func (r *macros) get(name string) ([]macroEvent, bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	events, ok := r.stored[name]
+	return events, ok
+}
+
+// handleRecord starts recording the macro named by the first argument,
+// /record without an argument stops and stores it.
+func (m *MidiBridge) handleRecord(args []string) {
+	if len(args) > 0 && args[0] != "" {
+		m.macros.start(args[0])
+		fmt.Printf("Recording macro %s\n", args[0])
+		return
+	}
+
+	if name, n := m.macros.stop(); name != "" {
+		fmt.Printf("Recorded macro %s with %d messages\n", name, n)
+	}
+}
+
+func (m *MidiBridge) playMacro(name string) {
+	events, ok := m.macros.get(name)
+	if !ok {
+		fmt.Printf("macro %s not recorded\n", name)
+		return
+	}
+
+	fmt.Printf("Playing macro %s\n", name)
+
+	start := time.Now()
+	for _, e := range events {
+		time.Sleep(time.Until(start.Add(e.at)))
+		m.Write(e.msg.Bytes())
+	}
+}
+
+// macroMap is a flag.Value mapping a trigger, like a MSC cue or a program
+// number, to the macro it plays as trigger=macro.
+type macroMap map[string]string
+
+func (mm macroMap) String() string {
+	var s []string
+	for trigger, macro := range mm {
+		s = append(s, trigger+"="+macro)
+	}
+	return strings.Join(s, ",")
+}
+
+func (mm macroMap) Set(s string) error {
+	trigger, macro, ok := strings.Cut(s, "=")
+	if !ok || trigger == "" || macro == "" {
+		return fmt.Errorf("want trigger=macro, got %q", s)
+	}
+	mm[trigger] = macro
+	return nil
+}
+
+// programMacro plays the macro mapped to msg if it is a program change,
+// it reports whether it did.
+func (m *MidiBridge) programMacro(msg Midi) bool {
+	if msg.Command() != PatchChange {
+		return false
+	}
+	name, ok := m.ProgramMacros[strconv.Itoa(int(msg.Note))]
+	if !ok {
+		return false
+	}
+	go m.playMacro(name)
+	return true
+}
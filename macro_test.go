@@ -0,0 +1,89 @@
+package main
+
+import (
+	"bytes"
+	"testing"
+	"time"
+)
+
+func TestMacroRecordAndPlay(t *testing.T) {
+	quiet(t)
+
+	const pause = 30 * time.Millisecond
+
+	m, out := testBridge(t, nil)
+	// nothing recorded before the first message counts to the timing
+	m.handleCmd(oscMessage(recordCall, "intro"), nil)
+	time.Sleep(pause)
+	m.handleCmd(legacyPacket(0x90, 60, 100), nil)
+	time.Sleep(pause)
+	m.handleCmd(legacyPacket(0x80, 60, 0), nil)
+	m.handleCmd(oscMessage(recordCall), nil)
+	m.handleCmd(legacyPacket(0x90, 62, 100), nil)
+
+	start := time.Now()
+	m.handleCmd(oscMessage(macroCall, "intro"), nil)
+	took := time.Since(start)
+	m.handleCmd(oscMessage(macroCall, "outro"), nil)
+	m.Close()
+
+	if took < pause {
+		t.Errorf("macro took %v to play, want at least %v", took, pause)
+	}
+	want := []byte{
+		0x90, 60, 100, 0x80, 60, 0, 0x90, 62, 100,
+		0x90, 60, 100, 0x80, 60, 0,
+	}
+	if got := out.Bytes(); !bytes.Equal(got, want) {
+		t.Errorf("wrote % X\nwant  % X", got, want)
+	}
+}
+
+func TestMacroRecordAgain(t *testing.T) {
+	quiet(t)
+
+	m, out := testBridge(t, nil)
+	for _, req := range [][]byte{
+		oscMessage(recordCall, "a"),
+		legacyPacket(0x90, 60, 100),
+		// starting again throws away what was recorded so far
+		oscMessage(recordCall, "a"),
+		legacyPacket(0x90, 62, 100),
+		oscMessage(recordCall),
+		// stopping twice keeps the macro
+		oscMessage(recordCall),
+		oscMessage(macroCall, "a"),
+	} {
+		m.handleCmd(req, nil)
+	}
+	m.Close()
+
+	want := []byte{0x90, 60, 100, 0x90, 62, 100, 0x90, 62, 100}
+	if got := out.Bytes(); !bytes.Equal(got, want) {
+		t.Errorf("wrote % X, want % X", got, want)
+	}
+}
+
+func TestProgramMacros(t *testing.T) {
+	quiet(t)
+
+	m, out := testBridge(t, func(m *MidiBridge) {
+		m.ProgramMacros = macroMap{"5": "intro"}
+	})
+	m.handleCmd(oscMessage(recordCall, "intro"), nil)
+	m.handleCmd(legacyPacket(0x90, 60, 100), nil)
+	m.handleCmd(oscMessage(recordCall), nil)
+
+	// mapped programs play their macro instead of changing the program
+	m.handleCmd(legacyPacket(0xC0, 6, 0), nil)
+	m.handleCmd(legacyPacket(0xC3, 5, 0), nil)
+
+	want := []byte{0x90, 60, 100, 0xC0, 6, 0x90, 60, 100}
+	deadline := time.Now().Add(5 * time.Second)
+	for !bytes.Equal(out.Bytes(), want) {
+		if time.Now().After(deadline) {
+			t.Fatalf("wrote % X, want % X", out.Bytes(), want)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
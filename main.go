@@ -44,12 +44,20 @@ I'm sure you will be able to infer how to set up the others by the end of this.
 package main
 
 import (
+	"bytes"
+	"encoding/json"
+	"errors"
 	"flag"
 	"fmt"
+	"io"
+	"io/fs"
 	"log"
 	"net"
 	"os"
+	"os/signal"
 	"sync"
+	"syscall"
+	"time"
 )
 
 const (
@@ -71,15 +79,95 @@ const (
 	port = ":12101"
 	udp  = `udp`
 
-	midiCall = `/midi`
+	midiCall    = `/midi`
+	patchCall   = `/patch`
+	holdCall    = `/hold`
+	releaseCall = `/release`
+	recordCall  = `/record`
+	macroCall   = `/macro`
+	mscCall     = `/msc`
+	activeCall  = `/activenotes`
+	mtcCall     = `/mtc`
+	profileCall = `/profile`
+	droneCall   = `/drone`
+	sweepCall   = `/sweep`
+	pingCall    = `/ping`
+	channelCall = `/channel`
+	statusCall  = `/status`
+
+	defaultProfile = `default`
+
+	notReadyReply     = `/notready`
+	disconnectedReply = `/disconnected`
+	connectedReply    = `/connected`
+	pongReply         = `/pong`
+)
+
+var (
+	midiInDev  = flag.String("midi-in", "", "midi in device [/dev/snd/midi... or tcp://host:port]")
+	midiOutDev = flag.String("midi-out", "", "midi out device [/dev/snd/midi... or tcp://host:port]")
+	midiDev    = flag.String("midi", "", "midi in and out device [/dev/snd/midi... or tcp://host:port]")
+
+	collapseCC = flag.Duration("collapse-cc", 0, "drop a controller value another client sent within this time [0 disables]")
+
+	notesPriority = flag.Int("notes-priority", 0, "forward only notes while more than this many messages wait for midi out [0 disables]")
+	thin          = flag.Int("thin", 0, "thin out continuous messages while more than this many messages wait for midi out [0 disables]")
+	thruDelay     = flag.Duration("thru-delay", 0, "delay every message to midi out by this constant time [0 disables]")
+	guard         = flag.Bool("guard", true, "refuse to write malformed messages to midi out")
+	dropStrayOffs = flag.Bool("drop-stray-offs", false, "drop note offs for notes that are not sounding")
+	channelGap    = flag.Duration("channel-gap", 0, "minimum time between two messages on the same channel, e.g. 500us [0 disables]")
+	reorderWindow = flag.Duration("reorder-window", 0, "hold a note off arriving before its note on this long for the note on, then drop it [0 disables]")
+	maxAge        = flag.Duration("max-age", 0, "drop messages that waited longer than this for midi out, note offs are always written [0 disables]")
+
+	notify = flag.String("notify", "", "send device /disconnected and /connected notifications to this host:port")
+
+	sweepPeriod = flag.Duration("sweep-period", 4*time.Second, "time /sweep takes up and down the range")
+
+	echo      = flag.Bool("echo", false, "reply the messages written for a packet in the format it came in")
+	codecName = flag.String("codec", "", "network payload format, empty auto detects it per packet")
+
+	grace       = flag.Duration("grace", 0, "time after opening the devices before network commands are handled")
+	graceReject = flag.Bool("grace-reject", false, "reply /notready to commands during the grace period instead of holding them back")
+
+	deadLetter     = flag.String("dead-letter", "", "record dropped messages to this file or udp://host:port")
+	deadLetterSize = flag.Int64("dead-letter-size", 1<<20, "rotate the dead letter file once it is this many bytes")
+
+	degraded = flag.Bool("degraded", false, "keep monitoring midi in if midi out can't be opened")
+
+	checkConfig = flag.Bool("check-config", false, "print the resolved configuration, validate it and exit")
+
+	pprofAddr = flag.String("pprof", "", "serve net/http/pprof profiles on this loopback host:port, e.g. localhost:6060")
+
+	identify = flag.Bool("identify", false, "send a sysex identity request to the midi out device on startup")
+
+	atomicNRPN = flag.Bool("atomic-nrpn", false, "write NRPN and RPN edits as one unit, never thinned, dropped or interleaved in part")
+	nrpnLSB    = flag.Bool("nrpn-lsb", false, "NRPN and RPN edits end with data entry LSB (cc 38) rather than MSB (cc 6)")
+
+	activeChannel = flag.Int("channel", -1, "remap everything played to this channel, /channel changes it [0-15, -1 disables]")
+	channelCC     = flag.Int("channel-cc", -1, "controller number that selects the channel to remap to [0-127]")
+
+	scriptPath = flag.String("script", "", "file of rules rewriting or dropping messages, see script.go for the format")
+
+	statePath   = flag.String("state", "", "keep the last controller values and the active profile in this file across restarts")
+	stateResend = flag.Bool("state-resend", false, "write the controller values kept in -state to midi out on startup")
 )
 
 var (
-	midiInDev  = flag.String("midi-in", "", "midi in device [/dev/snd/midi...]")
-	midiOutDev = flag.String("midi-out", "", "midi out device [/dev/snd/midi...]")
-	midiDev    = flag.String("midi", "", "midi in and out device [/dev/snd/midi...]")
+	pipelineConfig = newPipelineFlags(flag.CommandLine)
+	profileConfigs = profiles{}
+	mscCues        = macroMap{}
+	programMacros  = macroMap{}
 )
 
+func init() {
+	flag.Var(profileConfigs, "profile", "pipeline flags to switch to with /profile, name=\"-flag value ...\" (repeatable)")
+	flag.Var(mscCues, "msc-cue", "play a macro on a MIDI Show Control GO, cue=macro (repeatable)")
+	flag.Var(programMacros, "program-macro", "play a macro instead of a program change, program=macro (repeatable)")
+}
+
+// Midi is a channel message. For note off Velocity is the release velocity
+// and has to be passed on as is, controllers that send it expect the synth
+// to respond to it.
 type Midi struct {
 	State    byte
 	Channel  byte
@@ -97,31 +185,323 @@ func ToMidi(req []byte) Midi {
 	}
 }
 
+func (m Midi) Command() byte {
+	return m.State << 4
+}
+
+func (m Midi) Bytes() []byte {
+	status := m.State<<4 | m.Channel
+	switch dataBytes(status) {
+	case 0, -1:
+		return []byte{status}
+	case 1:
+		return []byte{status, m.Note}
+	}
+	return []byte{status, m.Note, m.Velocity}
+}
+
 type MidiBridge struct {
 	mu      sync.RWMutex
-	MidiIn  *os.File
-	MidiOut *os.File
+	MidiIn  io.Reader
+	MidiOut io.Writer
+
+	// NotesPriority is the output queue depth at which everything but
+	// notes gets dropped, 0 disables it.
+	NotesPriority int
+	// Thin is the output queue depth at which continuous messages replace
+	// older values of the same stream still waiting, 0 disables it.
+	Thin int
+	// MaxAge drops messages that waited longer than that for the midi out
+	// device, 0 disables it.
+	MaxAge time.Duration
+	// Delay holds every message back for that long after it was queued,
+	// so the latency is constant instead of jittery.
+	Delay time.Duration
+	// Guard refuses to write malformed messages to the midi out device.
+	Guard bool
+	// DropStrayOffs drops note offs for notes that are not sounding.
+	DropStrayOffs bool
+	// ReorderWindow holds back note offs for notes that are not sounding
+	// that long, a note on arriving meanwhile is written before them. 0
+	// handles them as DropStrayOffs says.
+	ReorderWindow time.Duration
+	// ChannelGap spaces consecutive messages on a channel at least that
+	// far apart, other channels are not held up by it.
+	ChannelGap time.Duration
+
+	// Conn is where network commands came in and replies go out.
+	Conn net.PacketConn
+
+	// Notify receives /disconnected and /connected from NotifyConn when a
+	// device drops and comes back.
+	Notify     net.Addr
+	NotifyConn net.PacketConn
+
+	// ReadyAt ends the startup grace period, commands that arrive earlier
+	// wait for it or are rejected with RejectEarly.
+	ReadyAt     time.Time
+	RejectEarly bool
+
+	// SweepPeriod is the time /sweep takes up and down the range.
+	SweepPeriod time.Duration
+
+	// Profiles build the transform pipelines /profile switches between.
+	Profiles map[string]func() []Transform
+
+	// CueMacros maps MIDI Show Control GO cues to the macro they play.
+	CueMacros map[string]string
+	// ProgramMacros maps program numbers to the macro played instead of
+	// the program change.
+	ProgramMacros map[string]string
+
+	// ActiveChannel is the channel everything played is remapped to, -1
+	// doesn't remap. ChannelCC selects it live, -1 disables that.
+	ActiveChannel int
+	ChannelCC     int
+
+	// Script filters every message after the transforms, nil doesn't.
+	Script *script
 
-	close chan bool
+	// NRPN writes NRPN and RPN edits as one unit, nil writes every
+	// controller on its own.
+	NRPN *nrpnGroups
+
+	// DeadLetters records dropped messages, nil discards them.
+	DeadLetters *deadLetters
+
+	// CollapseCC drops a controller value another source sent within that
+	// time, 0 disables it.
+	CollapseCC time.Duration
+
+	// Codec decodes network packets, nil auto detects it per packet.
+	Codec Codec
+	// Echo replies the messages written for a packet, encoded by the
+	// codec the packet was decoded with.
+	Echo bool
+
+	// StatePath is where the controller shadow and the active profile are
+	// saved on Close, empty doesn't save them.
+	StatePath string
+
+	queue     *outQueue
+	lastWrite [16]time.Time
+	active    *activeNotes
+	orphans   *orphanOffs
+	shadow    *ccShadow
+
+	pipeline   sync.Mutex
+	collapse   *ccCollapser
+	transforms []Transform
+	profile    string
+	hold       *hold
+	macros     *macros
+	bench      bench
+
+	// channelNotes maps notes held to the channel they were sent to,
+	// channelReleased are the notes released by a channel switch since
+	// they were played, whose own note off is swallowed
+	channelNotes    map[noteKey]byte
+	channelReleased map[noteKey]bool
+
+	// logBuf is reused by logMidi
+	logBuf []byte
+
+	sysex    []byte
+	identity *Identity
+	timecode *Timecode
+
+	drained   chan struct{}
+	close     chan bool
+	closeOnce sync.Once
 }
 
-func NewMidiBridge(in, out *os.File) *MidiBridge {
-	return &MidiBridge{
+func NewMidiBridge(in io.Reader, out io.Writer) *MidiBridge {
+	m := &MidiBridge{
+
+		MidiIn:          in,
+		MidiOut:         out,
+		ActiveChannel:   -1,
+		ChannelCC:       -1,
+		queue:           newOutQueue(),
+		active:          newActiveNotes(),
+		orphans:         newOrphanOffs(),
+		shadow:          newCCShadow(),
+		profile:         defaultProfile,
+		channelNotes:    map[noteKey]byte{},
+		channelReleased: map[noteKey]bool{},
+		hold:            newHold(),
+		macros:          newMacros(),
+		drained:         make(chan struct{}),
+		close:           make(chan bool),
+	}
 
-		MidiIn:  in,
-		MidiOut: out,
+	if out != nil {
+		go m.writeMidiOut()
+	} else {
+		close(m.drained)
 	}
+
+	return m
 }
 
+func (m *MidiBridge) Use(t Transform) {
+	m.transforms = append(m.transforms, t)
+}
+
+func (m *MidiBridge) transform(msg Midi) []Midi {
+	// remap first, the transforms work on the channel played to
+	return m.transformWith(m.transforms, m.channelize(msg))
+}
+
+func (m *MidiBridge) transformWith(ts []Transform, msgs []Midi) []Midi {
+	for _, t := range ts {
+		msgs = apply(t, msgs)
+	}
+	if m.Script != nil {
+		msgs = apply(m.Script.transform, msgs)
+	}
+	// hold comes last so it holds back the note offs as they are sent
+	return apply(m.hold.transform, msgs)
+}
+
+// release writes the notes pop hands over, held back by a transform,
+// through rest, the transforms after it.
+func (m *MidiBridge) release(rest []Transform, pop func() []Midi) {
+	m.pipeline.Lock()
+	defer m.pipeline.Unlock()
+
+	for _, out := range m.transformWith(rest, pop()) {
+		m.macros.record(out)
+		m.Write(out.Bytes())
+	}
+}
+
+func apply(t Transform, msgs []Midi) []Midi {
+	var out []Midi
+	for _, msg := range msgs {
+		out = append(out, t(msg)...)
+	}
+	return out
+}
+
+// Close stops the bench tools, writes what is still queued and stops
+// listening to the in device.
 func (m *MidiBridge) Close() {
-	m.close <- true
+	m.closeOnce.Do(func() {
+		m.stopDrone()
+		m.stopSweep()
+
+		m.queue.close()
+		<-m.drained
+
+		if err := m.saveState(); err != nil {
+			log.Println(err)
+		}
+
+		close(m.close)
+	})
 }
 
 func (m *MidiBridge) Write(data []byte) {
-	m.mu.Lock()
-	defer m.mu.Unlock()
+	if m.MidiOut == nil {
+		m.drop("no-midi-out", data)
+		return
+	}
 
-	m.MidiOut.Write(data)
+	if m.NRPN != nil {
+		var dropped []byte
+		if data, dropped = m.NRPN.collect(data); dropped != nil {
+			m.drop("nrpn-incomplete", dropped)
+		}
+		if data == nil {
+			return
+		}
+	}
+	group := nrpnGroup(data)
+
+	if m.NotesPriority > 0 && !group && suppressible(data) && m.queue.congested(m.NotesPriority) {
+		m.drop("notes-priority", data)
+		return
+	}
+
+	if !m.active.update(data) {
+		switch {
+		case m.ReorderWindow > 0:
+			m.orphans.hold(data, m.ReorderWindow, func(off []byte) {
+				m.drop("orphan-note-off", off)
+			})
+			return
+		case m.DropStrayOffs:
+			m.drop("stray-note-off", data)
+			return
+		}
+	}
+
+	m.shadow.update(data)
+
+	if m.Thin > 0 && !group && continuous(data) {
+		if thinned := m.queue.thin(data, m.Thin); thinned != nil {
+			m.drop("thinned", thinned)
+		}
+		return
+	}
+
+	m.queue.push(data)
+
+	if off := m.orphans.claim(data); off != nil {
+		m.Write(off)
+	}
+}
+
+func (m *MidiBridge) writeMidiOut() {
+	defer close(m.drained)
+
+	for {
+		item, wait, ok := m.queue.pop(m.channelWait)
+		if !ok {
+			return
+		}
+		if wait > 0 {
+			m.queue.sleep(wait)
+			continue
+		}
+
+		// note offs are always written, dropping them would hang notes
+		if m.MaxAge > 0 && time.Since(item.at) > m.MaxAge && !releasesNote(item.data) {
+			m.drop("stale", item.data)
+			continue
+		}
+
+		if m.Delay > 0 {
+			time.Sleep(time.Until(item.at.Add(m.Delay)))
+		}
+
+		if m.Guard {
+			if err := validMessages(item.data); err != nil {
+				log.Printf("not writing % X: %v", item.data, err)
+				m.drop("malformed", item.data)
+				continue
+			}
+		}
+
+		if _, err := m.MidiOut.Write(item.data); err != nil {
+			log.Println(err)
+			m.drop("write-error", item.data)
+		}
+
+		if len(item.data) > 0 && item.data[0] < SysExC {
+			m.lastWrite[item.data[0]&0x0f] = time.Now()
+		}
+	}
+}
+
+// channelWait is how long data has to wait to keep ChannelGap to the last
+// message written on its channel.
+func (m *MidiBridge) channelWait(data []byte) time.Duration {
+	if m.ChannelGap <= 0 || len(data) == 0 || data[0] >= SysExC {
+		return 0
+	}
+	return time.Until(m.lastWrite[data[0]&0x0f].Add(m.ChannelGap))
 }
 
 func (m *MidiBridge) ListenMidiIn() {
@@ -131,6 +511,12 @@ func (m *MidiBridge) ListenMidiIn() {
 		for {
 			n, err := m.MidiIn.Read(buf)
 			if err != nil {
+				select {
+				case <-m.close:
+					// closed on the way out
+					return
+				default:
+				}
 				log.Fatal(err)
 			}
 			bufCopy := make([]byte, n)
@@ -153,32 +539,269 @@ func (m *MidiBridge) handleDeviceIn(req []byte) {
 		fmt.Printf("%08b", req[i])
 	}
 	fmt.Println()
+
+	m.readSysEx(req)
 }
 
-func (m *MidiBridge) handleBridgeIn(req []byte) {
+func (m *MidiBridge) handleBridgeIn(codec Codec, req []byte, addr net.Addr) {
 
-	if len(req) != 11 {
+	msgs, err := codec.Decode(req)
+	if err != nil {
+		log.Printf("%s: %v", codec.Name(), err)
+		m.drop("undecodable", req)
 		return
 	}
 
-	fmt.Printf("MidiNote: %+v\n", ToMidi(req))
+	m.pipeline.Lock()
+	defer m.pipeline.Unlock()
+
+	var echo []Midi
+	for _, msg := range msgs {
+		m.logMidi(msg)
 
-	m.Write([]byte{req[10], req[9], req[8]})
+		// a repeated parameter number is part of an edit, not a duplicate
+		nrpn := m.NRPN != nil && msg.Command() == ContinuousContr && nrpnCC(msg.Note)
+		if m.CollapseCC > 0 && addr != nil && !nrpn && m.collapser().duplicate(msg, addr.String()) {
+			m.drop("duplicate-cc", msg.Bytes())
+			continue
+		}
+
+		if m.programMacro(msg) {
+			continue
+		}
+
+		outs := m.transform(msg)
+		if len(outs) == 0 {
+			// swallowed by a transform or the script, note offs a pedal
+			// or /hold holds back show up here and are written later
+			m.drop("filtered", msg.Bytes())
+		}
+		for _, out := range outs {
+			m.macros.record(out)
+			m.Write(out.Bytes())
+			echo = append(echo, out)
+		}
+	}
+
+	// echo in the codec the packet came in, so every client can read it
+	if m.Echo && len(echo) > 0 {
+		for _, packet := range codec.Encode(echo) {
+			m.reply(addr, packet)
+		}
+	}
 }
 
-func (m *MidiBridge) handleCmd(req []byte) {
+// handlePatch switches channel to a bank and program. The packet is laid
+// out like /midi, the last four bytes hold channel, bank msb, bank lsb and
+// program in the same reversed order.
+func (m *MidiBridge) handlePatch(req []byte) {
+
+	if len(req) != 10 {
+		return
+	}
+
+	channel := req[9] & 0x0f
+	msb, lsb, program := req[8]&0x7f, req[7]&0x7f, req[6]&0x7f
+
+	fmt.Printf("MidiPatch: channel %d bank %d:%d program %d\n", channel, msb, lsb, program)
+
+	if m.MidiOut == nil {
+		return
+	}
+
+	// queue all three at once so no other message ends up between bank
+	// select and program change
+	m.queue.push(
+		[]byte{ContinuousContr | channel, bankSelectMSB, msb},
+		[]byte{ContinuousContr | channel, bankSelectLSB, lsb},
+		[]byte{PatchChange | channel, program},
+	)
+}
+
+func (m *MidiBridge) reply(addr net.Addr, data []byte) {
+	if m.Conn == nil || addr == nil {
+		return
+	}
+	if _, err := m.Conn.WriteTo(data, addr); err != nil {
+		log.Println(err)
+	}
+}
+
+// notifyDevice returns the callback telling Notify about path dropping
+// and coming back.
+func (m *MidiBridge) notifyDevice(path string) func(bool) {
+	return func(connected bool) {
+		if m.NotifyConn == nil || m.Notify == nil {
+			return
+		}
+		msg := oscMessage(disconnectedReply, path)
+		if connected {
+			msg = oscMessage(connectedReply, path)
+		}
+		if _, err := m.NotifyConn.WriteTo(msg, m.Notify); err != nil {
+			log.Println(err)
+		}
+	}
+}
+
+// ready holds back or rejects commands that arrive during the startup grace
+// period, it reports whether the command may be handled.
+func (m *MidiBridge) ready(addr net.Addr) bool {
+	wait := time.Until(m.ReadyAt)
+	if wait <= 0 {
+		return true
+	}
+
+	if m.RejectEarly {
+		m.reply(addr, oscMessage(notReadyReply))
+		return false
+	}
+
+	time.Sleep(wait)
+	return true
+}
+
+// packetReader is what serve reads network commands from, a
+// net.PacketConn.
+type packetReader interface {
+	ReadFrom(p []byte) (n int, addr net.Addr, err error)
+}
+
+// packetSlab is how much serve reads packets into at once, handleCmd may
+// keep a packet so every one gets its own part of the slab.
+const packetSlab = 64 * 1024
+
+// serve hands every packet read from conn to handleCmd until conn is
+// closed.
+func (m *MidiBridge) serve(conn packetReader) {
+	var slab []byte
+
+	for {
+		if len(slab) < 1024 {
+			slab = make([]byte, packetSlab)
+		}
+
+		n, addr, err := conn.ReadFrom(slab[:1024])
+		if errors.Is(err, syscall.EINTR) {
+			// interrupted by a signal, nothing was read
+			continue
+		}
+		if errors.Is(err, net.ErrClosed) {
+			return
+		}
+		if err != nil {
+			log.Println(err)
+			continue
+		}
+
+		req := slab[:n:n]
+		slab = slab[n:]
+		go m.handleCmd(req, addr)
+	}
+}
+
+func (m *MidiBridge) handleCmd(req []byte, addr net.Addr) {
+
+	// answer pings right away, they measure the bridge not the device
+	if bytes.HasPrefix(req, []byte(pingCall)) {
+		m.reply(addr, append([]byte(pongReply), req[len(pingCall):]...))
+		return
+	}
+
+	if !m.ready(addr) {
+		m.drop("not-ready", req)
+		return
+	}
 
 	switch {
-	case string(req[:len(midiCall)]) == midiCall:
-		req := req[len(midiCall):]
-		m.handleBridgeIn(req)
+	case bytes.HasPrefix(req, []byte(patchCall)):
+		req := req[len(patchCall):]
+		m.handlePatch(req)
+
+	case bytes.HasPrefix(req, []byte(holdCall)):
+		m.pipeline.Lock()
+		m.hold.on = true
+		m.pipeline.Unlock()
+
+	case bytes.HasPrefix(req, []byte(recordCall)):
+		m.handleRecord(oscStrings(req))
+
+	case bytes.HasPrefix(req, []byte(macroCall)):
+		if args := oscStrings(req); len(args) > 0 {
+			m.playMacro(args[0])
+		}
+
+	case bytes.HasPrefix(req, []byte(mscCall)):
+		m.handleMSC(oscStrings(req))
+
+	case bytes.HasPrefix(req, []byte(droneCall)):
+		m.handleDrone(oscStrings(req))
+
+	case bytes.HasPrefix(req, []byte(sweepCall)):
+		m.handleSweep(oscStrings(req))
+
+	case bytes.HasPrefix(req, []byte(profileCall)):
+		if args := oscStrings(req); len(args) > 0 {
+			m.switchProfile(args[0])
+		}
+
+	case bytes.HasPrefix(req, []byte(mtcCall)):
+		m.handleMTC(oscStrings(req))
+
+	case bytes.HasPrefix(req, []byte(activeCall)):
+		data, err := json.Marshal(m.active.list())
+		if err != nil {
+			log.Println(err)
+			return
+		}
+		m.reply(addr, data)
+
+	case bytes.HasPrefix(req, []byte(statusCall)):
+		data, err := json.Marshal(m.status())
+		if err != nil {
+			log.Println(err)
+			return
+		}
+		m.reply(addr, data)
+
+	case bytes.HasPrefix(req, []byte(channelCall)):
+		m.handleChannel(oscStrings(req))
+
+	case bytes.HasPrefix(req, []byte(releaseCall)):
+		m.pipeline.Lock()
+		for _, out := range m.hold.release() {
+			m.Write(out.Bytes())
+		}
+		m.pipeline.Unlock()
 
 	default:
-		fmt.Printf("%s not implemeted\n", req)
+		codec := m.Codec
+		if codec == nil {
+			codec = detectCodec(req)
+		}
+		if codec == nil || !codec.Match(req) {
+			fmt.Printf("%s not implemeted\n", req)
+			m.drop("unknown-command", req)
+			return
+		}
+		if _, ok := codec.(legacyCodec); ok && m.legacyNote(req) {
+			return
+		}
+		m.handleBridgeIn(codec, req, addr)
 	}
 
 }
 
+// deviceError explains the most common first run problem, a device the
+// user is not allowed to open.
+func deviceError(dev string, err error) error {
+	if errors.Is(err, fs.ErrPermission) {
+		return fmt.Errorf("%s: permission denied, add your user to the audio and dialout groups "+
+			"(sudo usermod -aG audio,dialout $USER) and log in again", dev)
+	}
+	return err
+}
+
 func main() {
 
 	flag.Parse()
@@ -188,41 +811,219 @@ func main() {
 		*midiOutDev = *midiDev
 	}
 
-	midiIn, err := os.OpenFile(*midiInDev, os.O_RDONLY, 0666)
-	if err != nil {
-		log.Fatal(err)
+	errs := validateFlags()
+	if *checkConfig {
+		printFlags()
+	}
+	if len(errs) > 0 {
+		for _, err := range errs {
+			log.Println(err)
+		}
+		os.Exit(1)
 	}
-	defer midiIn.Close()
-	midiOut, err := os.OpenFile(*midiOutDev, os.O_WRONLY, 0666)
+	if *checkConfig {
+		return
+	}
+
+	s, err := start(port)
 	if err != nil {
 		log.Fatal(err)
 	}
-	defer midiOut.Close()
+	defer s.close()
+
+	sig := make(chan os.Signal, 1)
+	signal.Notify(sig, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		<-sig
+		s.bridge.Close()
+		os.Exit(0)
+	}()
 
-	bridge := NewMidiBridge(midiIn, midiOut)
-	defer bridge.Close()
+	s.run()
+}
 
-	go bridge.ListenMidiIn()
+// startup is what main starts from the flags. Either device may be
+// missing, conn is only there with a midi out to bridge commands to,
+// notify only with -notify and pprof only with -pprof.
+type startup struct {
+	bridge          *MidiBridge
+	midiIn, midiOut io.ReadWriteCloser
+	conn            net.PacketConn
+	notify          net.PacketConn
+	pprof           net.Listener
+}
 
-	udpSrv, err := net.ListenPacket(udp, port)
-	if err != nil {
-		log.Fatal(err)
+// start opens the devices the flags name, sets up the bridge for them and
+// listens for network commands on addr if there is a midi out.
+func start(addr string) (s *startup, err error) {
+	s = &startup{}
+	defer func() {
+		if err != nil {
+			s.close()
+		}
+	}()
+
+	// devices notify from the moment they are open, and without a midi
+	// out there is no command listener to send from
+	var notifyAddr net.Addr
+	if *notify != "" {
+		notifyAddr, err = net.ResolveUDPAddr(udp, *notify)
+		if err != nil {
+			return s, err
+		}
+		s.notify, err = net.ListenPacket(udp, ":0")
+		if err != nil {
+			return s, err
+		}
 	}
-	defer udpSrv.Close()
 
-	buf := make([]byte, 1024)
+	if *midiInDev != "" {
+		s.midiIn, err = openDevice(*midiInDev, os.O_RDONLY)
+		if err != nil {
+			return s, deviceError(*midiInDev, err)
+		}
 
-	for {
+		// a serial to TCP server takes a single connection, share it
+		if *midiOutDev == *midiInDev && isTCPDevice(*midiInDev) {
+			s.midiOut = s.midiIn
+		}
+	}
+	if *midiOutDev != "" && s.midiOut == nil {
+		s.midiOut, err = openDevice(*midiOutDev, os.O_WRONLY)
+		switch {
+		case err == nil:
+		case *degraded && s.midiIn != nil:
+			log.Printf("%v, continuing monitor only", deviceError(*midiOutDev, err))
+			s.midiOut, err = nil, nil
+		default:
+			return s, deviceError(*midiOutDev, err)
+		}
+	}
 
-		n, addr, err := udpSrv.ReadFrom(buf)
-		fmt.Println("Received ", string(buf[0:n]), " from ", addr)
+	bridge := NewMidiBridge(s.midiIn, s.midiOut)
+	s.bridge = bridge
 
+	bridge.NotesPriority = *notesPriority
+	bridge.Thin = *thin
+	bridge.MaxAge = *maxAge
+	bridge.Delay = *thruDelay
+	bridge.ChannelGap = *channelGap
+	bridge.DropStrayOffs = *dropStrayOffs
+	bridge.ReorderWindow = *reorderWindow
+	bridge.Guard = *guard
+	bridge.ReadyAt = time.Now().Add(*grace)
+	bridge.RejectEarly = *graceReject
+	bridge.CueMacros = mscCues
+	bridge.ProgramMacros = programMacros
+	bridge.CollapseCC = *collapseCC
+	if *scriptPath != "" {
+		bridge.Script, err = loadScript(*scriptPath)
 		if err != nil {
-			log.Println(err)
+			return s, err
+		}
+	}
+	bridge.ActiveChannel = *activeChannel
+	bridge.ChannelCC = *channelCC
+	if *atomicNRPN {
+		bridge.NRPN = newNRPNGroups(*nrpnLSB)
+	}
+	if *deadLetter != "" {
+		bridge.DeadLetters, err = openDeadLetters(*deadLetter, *deadLetterSize)
+		if err != nil {
+			return s, err
 		}
+	}
+	bridge.Echo = *echo
+	bridge.SweepPeriod = *sweepPeriod
+	bridge.Notify = notifyAddr
+	bridge.NotifyConn = s.notify
+	if d, ok := s.midiIn.(*tcpDevice); ok {
+		d.setNotify(bridge.notifyDevice(*midiInDev))
+	}
+	if d, ok := s.midiOut.(*tcpDevice); ok {
+		d.setNotify(bridge.notifyDevice(*midiOutDev))
+	}
+	if *codecName != "" {
+		bridge.Codec = codecs[*codecName]
+	}
+
+	for _, t := range pipelineConfig.transforms(bridge.release) {
+		bridge.Use(t)
+	}
+
+	bridge.Profiles = map[string]func() []Transform{
+		defaultProfile: func() []Transform { return pipelineConfig.transforms(bridge.release) },
+	}
+	for name, cfg := range profileConfigs {
+		cfg := cfg
+		bridge.Profiles[name] = func() []Transform { return cfg.transforms(bridge.release) }
+	}
 
-		bufCopy := make([]byte, n)
-		copy(bufCopy, buf)
-		go bridge.handleCmd(bufCopy)
+	if *statePath != "" {
+		state, err := loadState(*statePath)
+		if err != nil {
+			return s, err
+		}
+		bridge.StatePath = *statePath
+		bridge.restoreState(state, *stateResend)
+	}
+
+	if *pprofAddr != "" {
+		s.pprof, err = net.Listen("tcp", *pprofAddr)
+		if err != nil {
+			return s, err
+		}
+		go servePprof(s.pprof)
+	}
+
+	if *identify {
+		bridge.Write(identityRequest)
+	}
+
+	// without an out device there is nothing to bridge network commands
+	// to, only listen to the in device
+	if s.midiOut != nil {
+		s.conn, err = net.ListenPacket(udp, addr)
+		if err != nil {
+			return s, err
+		}
+		bridge.Conn = s.conn
+	}
+
+	return s, nil
+}
+
+// run listens to the in device and serves network commands until the
+// bridge is closed.
+func (s *startup) run() {
+	if s.conn == nil {
+		s.bridge.ListenMidiIn()
+		return
+	}
+	if s.midiIn != nil {
+		go s.bridge.ListenMidiIn()
+	}
+	s.bridge.serve(s.conn)
+}
+
+// close closes the bridge, then what start opened.
+func (s *startup) close() {
+	if s.bridge != nil {
+		s.bridge.Close()
+	}
+	if s.conn != nil {
+		s.conn.Close()
+	}
+	if s.notify != nil {
+		s.notify.Close()
+	}
+	if s.pprof != nil {
+		s.pprof.Close()
+	}
+	if s.midiOut != nil && s.midiOut != s.midiIn {
+		s.midiOut.Close()
+	}
+	if s.midiIn != nil {
+		s.midiIn.Close()
 	}
 }
@@ -0,0 +1,782 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"io/fs"
+	"log"
+	"net"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"sync"
+	"syscall"
+	"testing"
+	"time"
+)
+
+// midiOut collects what the bridge writes to the midi out device.
+type midiOut struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (o *midiOut) Write(p []byte) (int, error) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	return o.buf.Write(p)
+}
+
+func (o *midiOut) Bytes() []byte {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	return append([]byte(nil), o.buf.Bytes()...)
+}
+
+// drops collects the dead letters of a bridge.
+type drops struct {
+	midiOut
+}
+
+func (d *drops) Close() error { return nil }
+
+// reasons are the reasons given for each dropped message, in order.
+func (d *drops) reasons() []string {
+	var reasons []string
+	for _, line := range strings.Split(strings.TrimSpace(string(d.Bytes())), "\n") {
+		if f := strings.Fields(line); len(f) > 1 {
+			reasons = append(reasons, f[1])
+		}
+	}
+	return reasons
+}
+
+// recordDrops sends the dead letters of m to the returned drops.
+func recordDrops(m *MidiBridge) *drops {
+	d := &drops{}
+	m.DeadLetters = &deadLetters{w: d}
+	return d
+}
+
+// testBridge returns a bridge writing to out, set up by setup before the
+// first message. Closing it waits for everything queued to be written.
+func testBridge(t testing.TB, setup func(m *MidiBridge)) (*MidiBridge, *midiOut) {
+	t.Helper()
+
+	out := &midiOut{}
+	m := NewMidiBridge(nil, out)
+	if setup != nil {
+		setup(m)
+	}
+	t.Cleanup(m.Close)
+	return m, out
+}
+
+// legacyPacket is a /midi packet for status, data1 and data2.
+func legacyPacket(status, data1, data2 byte) []byte {
+	return append([]byte(midiCall), 0, 0, 0, 0, 0, 0, 0, 0, data2, data1, status)
+}
+
+// patchPacket is a /patch packet, args are program, bank LSB, bank MSB
+// and channel.
+func patchPacket(args ...byte) []byte {
+	return append([]byte(patchCall+"\x00\x00\x00\x00\x00\x00"), args...)
+}
+
+func udpAddr(port int) net.Addr {
+	return &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1), Port: port}
+}
+
+// passThrough forces packets through the decoder and the pipeline.
+func passThrough(msg Midi) []Midi {
+	return []Midi{msg}
+}
+
+// quiet sends the per message log to /dev/null for the test.
+func quiet(t testing.TB) {
+	t.Helper()
+
+	null, err := os.OpenFile(os.DevNull, os.O_WRONLY, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	stdout := os.Stdout
+	os.Stdout = null
+	t.Cleanup(func() {
+		os.Stdout = stdout
+		null.Close()
+	})
+}
+
+func TestLegacyNoteMatchesDecoder(t *testing.T) {
+	quiet(t)
+
+	packets := [][]byte{
+		legacyPacket(0x90, 60, 100),
+		legacyPacket(0x9F, 127, 1),
+		legacyPacket(0x90, 60, 0),
+		legacyPacket(0x80, 60, 64),
+		legacyPacket(0x85, 0, 127),
+		// not notes, both take the decoder
+		legacyPacket(0xB0, 7, 100),
+		legacyPacket(0xE0, 0, 64),
+		legacyPacket(0x90, 0x80, 100),
+		append(legacyPacket(0x90, 60, 100), 0),
+	}
+
+	fast, fastOut := testBridge(t, nil)
+	slow, slowOut := testBridge(t, func(m *MidiBridge) { m.Use(passThrough) })
+	for _, p := range packets {
+		fast.handleCmd(append([]byte(nil), p...), nil)
+		slow.handleCmd(append([]byte(nil), p...), nil)
+	}
+	fast.Close()
+	slow.Close()
+
+	if !bytes.Equal(fastOut.Bytes(), slowOut.Bytes()) {
+		t.Errorf("fast path wrote % X\ndecoder wrote   % X", fastOut.Bytes(), slowOut.Bytes())
+	}
+}
+
+func TestLegacyNoteTakenOnlyWhenPlain(t *testing.T) {
+	tests := []struct {
+		name  string
+		setup func(m *MidiBridge)
+		want  bool
+	}{
+		{"plain", func(m *MidiBridge) {}, true},
+		{"transform", func(m *MidiBridge) { m.Use(passThrough) }, false},
+		{"hold", func(m *MidiBridge) { m.hold.on = true }, false},
+		{"channel", func(m *MidiBridge) { m.ActiveChannel = 1 }, false},
+		{"collapse", func(m *MidiBridge) { m.CollapseCC = time.Second }, false},
+		{"echo", func(m *MidiBridge) { m.Echo = true }, false},
+		{"script", func(m *MidiBridge) { m.Script = &script{} }, false},
+	}
+
+	quiet(t)
+	for _, tt := range tests {
+		m, _ := testBridge(t, tt.setup)
+		if got := m.legacyNote(legacyPacket(0x90, 60, 100)); got != tt.want {
+			t.Errorf("%s: legacyNote = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestLegacyNoteAllocs(t *testing.T) {
+	quiet(t)
+
+	m := NewMidiBridge(nil, io.Discard)
+	defer m.Close()
+
+	packet := legacyPacket(0x90, 60, 100)
+	req := make([]byte, len(packet))
+	allocs := testing.AllocsPerRun(1000, func() {
+		copy(req, packet)
+		m.handleCmd(req, nil)
+	})
+	if allocs != 0 {
+		t.Errorf("%v allocations per note packet, want 0", allocs)
+	}
+}
+
+// benchmarkLegacyNote measures a note packet through to midi out.
+func benchmarkLegacyNote(b *testing.B, setup func(m *MidiBridge)) {
+	quiet(b)
+
+	m := NewMidiBridge(nil, io.Discard)
+	defer m.Close()
+	setup(m)
+
+	packet := legacyPacket(0x90, 60, 100)
+	req := make([]byte, len(packet))
+
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		copy(req, packet)
+		m.handleCmd(req, nil)
+	}
+}
+
+func BenchmarkLegacyNoteFast(b *testing.B) {
+	benchmarkLegacyNote(b, func(m *MidiBridge) {})
+}
+
+func BenchmarkLegacyNoteDecode(b *testing.B) {
+	benchmarkLegacyNote(b, func(m *MidiBridge) { m.Use(passThrough) })
+}
+
+// repeatedPacket reads the same packet n times, then reports the
+// connection closed.
+type repeatedPacket struct {
+	data []byte
+	n    int
+}
+
+func (r *repeatedPacket) ReadFrom(p []byte) (int, net.Addr, error) {
+	if r.n == 0 {
+		return 0, nil, net.ErrClosed
+	}
+	r.n--
+	return copy(p, r.data), nil, nil
+}
+
+// countingOut discards what is written to it and counts the bytes.
+type countingOut struct {
+	mu sync.Mutex
+	n  int
+}
+
+func (c *countingOut) Write(p []byte) (int, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.n += len(p)
+	return len(p), nil
+}
+
+// wait waits for n bytes, serve handles packets after it returns.
+func (c *countingOut) wait(t testing.TB, n int) {
+	t.Helper()
+
+	deadline := time.Now().Add(10 * time.Second)
+	for time.Now().Before(deadline) {
+		c.mu.Lock()
+		written := c.n
+		c.mu.Unlock()
+		if written >= n {
+			return
+		}
+		time.Sleep(time.Millisecond)
+	}
+	t.Fatalf("not all of %d bytes written", n)
+}
+
+func TestServeAllocs(t *testing.T) {
+	quiet(t)
+
+	out := &countingOut{}
+	m := NewMidiBridge(nil, out)
+	defer m.Close()
+
+	const packets = 10000
+	runs := 0
+	allocs := testing.AllocsPerRun(10, func() {
+		m.serve(&repeatedPacket{legacyPacket(0x90, 60, 100), packets})
+		runs++
+	})
+	out.wait(t, runs*packets*3)
+
+	// the goroutine handling the packet is all serve allocates, the
+	// runtime adds some when many run at once
+	if perPacket := allocs / packets; perPacket >= 2 {
+		t.Errorf("%v allocations per note packet, want about 1", perPacket)
+	}
+}
+
+func BenchmarkServeLegacyNote(b *testing.B) {
+	quiet(b)
+
+	out := &countingOut{}
+	m := NewMidiBridge(nil, out)
+	defer m.Close()
+
+	b.ReportAllocs()
+	m.serve(&repeatedPacket{legacyPacket(0x90, 60, 100), b.N})
+	out.wait(b, b.N*3)
+}
+
+// packetConn records the replies the bridge sends.
+type packetConn struct {
+	net.PacketConn
+
+	mu   sync.Mutex
+	sent []sentPacket
+}
+
+type sentPacket struct {
+	data []byte
+	addr string
+}
+
+func (c *packetConn) WriteTo(p []byte, addr net.Addr) (int, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.sent = append(c.sent, sentPacket{append([]byte(nil), p...), addr.String()})
+	return len(p), nil
+}
+
+func (c *packetConn) packets() []sentPacket {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return append([]sentPacket(nil), c.sent...)
+}
+
+// packetReads plays back reads, then reports the connection closed.
+type packetReads []packetRead
+
+type packetRead struct {
+	data []byte
+	err  error
+}
+
+func (r *packetReads) ReadFrom(p []byte) (int, net.Addr, error) {
+	if len(*r) == 0 {
+		return 0, nil, net.ErrClosed
+	}
+	read := (*r)[0]
+	*r = (*r)[1:]
+	if read.err != nil {
+		return 0, nil, read.err
+	}
+	return copy(p, read.data), udpAddr(1), nil
+}
+
+func TestServeRetriesInterrupted(t *testing.T) {
+	quiet(t)
+
+	var logged bytes.Buffer
+	log.SetOutput(&logged)
+	t.Cleanup(func() { log.SetOutput(os.Stderr) })
+
+	m, out := testBridge(t, nil)
+	m.serve(&packetReads{
+		{err: &net.OpError{Op: "read", Net: udp, Err: os.NewSyscallError("recvfrom", syscall.EINTR)}},
+		{data: legacyPacket(0x90, 60, 100)},
+		{err: syscall.EINTR},
+		{err: errors.New("connection refused")},
+		{data: legacyPacket(0x80, 60, 0)},
+	})
+
+	// packets are handled concurrently, in any order
+	deadline := time.Now().Add(5 * time.Second)
+	for len(out.Bytes()) < 6 && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+	got := out.Bytes()
+	if !bytes.Equal(got, []byte{0x90, 60, 100, 0x80, 60, 0}) && !bytes.Equal(got, []byte{0x80, 60, 0, 0x90, 60, 100}) {
+		t.Errorf("wrote % X, want both packets", got)
+	}
+
+	if lines := strings.Count(logged.String(), "\n"); lines != 1 || !strings.Contains(logged.String(), "connection refused") {
+		t.Errorf("logged %q, want only the genuine error", logged.String())
+	}
+}
+
+func TestOutputOnlyBridge(t *testing.T) {
+	quiet(t)
+
+	m, out := testBridge(t, nil)
+	m.handleCmd(legacyPacket(0x90, 60, 100), nil)
+	m.handleCmd(legacyPacket(0xB0, 7, 90), nil)
+	m.Close()
+
+	want := []byte{0x90, 60, 100, 0xB0, 7, 90}
+	if got := out.Bytes(); !bytes.Equal(got, want) {
+		t.Errorf("wrote % X, want % X", got, want)
+	}
+}
+
+func TestInputOnlyBridge(t *testing.T) {
+	quiet(t)
+
+	// the pipe is never closed, the reader would take that for a lost
+	// device and exit
+	in, dev := io.Pipe()
+	m := NewMidiBridge(in, nil)
+
+	listening := make(chan struct{})
+	go func() {
+		m.ListenMidiIn()
+		close(listening)
+	}()
+
+	dev.Write(rolandIdentity)
+	// network commands have nowhere to go but must not fail
+	m.handleCmd(legacyPacket(0x90, 60, 100), nil)
+	m.Write([]byte{0x90, 60, 100})
+
+	deadline := time.Now().Add(5 * time.Second)
+	for m.status().Identity == "" {
+		if time.Now().After(deadline) {
+			t.Fatal("identity reply read from the device never showed up")
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	m.Close()
+	select {
+	case <-listening:
+	case <-time.After(5 * time.Second):
+		t.Fatal("ListenMidiIn still running after Close")
+	}
+}
+
+func TestPatch(t *testing.T) {
+	tests := []struct {
+		name string
+		req  []byte
+		want []byte
+	}{
+		{
+			name: "bank and program",
+			req:  patchPacket(5, 2, 1, 3),
+			want: []byte{0xB3, bankSelectMSB, 1, 0xB3, bankSelectLSB, 2, 0xC3, 5},
+		},
+		{
+			name: "high bits are masked",
+			req:  patchPacket(0x85, 0xFF, 0x80, 0x1F),
+			want: []byte{0xBF, bankSelectMSB, 0, 0xBF, bankSelectLSB, 0x7F, 0xCF, 5},
+		},
+		{
+			name: "short",
+			req:  patchPacket(5, 2, 1),
+		},
+		{
+			name: "long",
+			req:  patchPacket(5, 2, 1, 3, 0),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			quiet(t)
+
+			m, out := testBridge(t, nil)
+			m.handleCmd(tt.req, nil)
+			m.Close()
+
+			if got := out.Bytes(); !bytes.Equal(got, tt.want) {
+				t.Errorf("wrote % X, want % X", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPatchNotInterleaved(t *testing.T) {
+	quiet(t)
+
+	// thinning takes out the controller queued ahead of the patch, the
+	// patch itself stays in one piece
+	m, out := stalledBridge(t, func(m *MidiBridge) { m.Thin = 1 }, []byte{0x90, 60, 100})
+	m.Write([]byte{0xB0, 7, 1})
+	m.handleCmd(patchPacket(5, 2, 1, 0), nil)
+	m.Write([]byte{0xB0, 7, 2})
+	close(out.release)
+	m.Close()
+
+	want := []byte{
+		0x90, 60, 100,
+		0xB0, bankSelectMSB, 1, 0xB0, bankSelectLSB, 2, 0xC0, 5,
+		0xB0, 7, 2,
+	}
+	if got := out.Bytes(); !bytes.Equal(got, want) {
+		t.Errorf("wrote % X\nwant  % X", got, want)
+	}
+}
+
+func TestDeviceError(t *testing.T) {
+	denied := &fs.PathError{Op: "open", Path: "/dev/snd/midiC1D0", Err: fs.ErrPermission}
+	if err := deviceError("/dev/snd/midiC1D0", denied); !strings.Contains(err.Error(), "usermod -aG audio,dialout") {
+		t.Errorf("permission error %q doesn't explain the groups", err)
+	}
+
+	// everything else is passed on as is
+	missing := &fs.PathError{Op: "open", Path: "/dev/snd/midiC9D0", Err: fs.ErrNotExist}
+	if err := deviceError("/dev/snd/midiC9D0", missing); err != missing {
+		t.Errorf("got %v, want %v", err, missing)
+	}
+
+	_, err := openDevice(filepath.Join(t.TempDir(), "none"), os.O_WRONLY)
+	if err := deviceError("none", err); !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("missing device gave %v", err)
+	}
+}
+
+func TestGrace(t *testing.T) {
+	quiet(t)
+
+	const grace = 50 * time.Millisecond
+
+	tests := []struct {
+		name   string
+		reject bool
+		// want is written and replied once the grace period is over
+		want    []byte
+		replies []sentPacket
+		drops   []string
+	}{
+		{
+			name: "held back",
+			want: []byte{0x90, 60, 100},
+			replies: []sentPacket{
+				{append([]byte(pongReply), "\x00\x00\x00"...), udpAddr(1).String()},
+			},
+		},
+		{
+			name:   "rejected",
+			reject: true,
+			replies: []sentPacket{
+				{append([]byte(pongReply), "\x00\x00\x00"...), udpAddr(1).String()},
+				{oscMessage(notReadyReply), udpAddr(1).String()},
+			},
+			drops: []string{"not-ready"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			conn := &packetConn{}
+			m, out := testBridge(t, func(m *MidiBridge) {
+				m.Conn = conn
+				m.ReadyAt = time.Now().Add(grace)
+				m.RejectEarly = tt.reject
+			})
+			d := recordDrops(m)
+
+			start := time.Now()
+			// pings are answered right away
+			m.handleCmd([]byte(pingCall+"\x00\x00\x00"), udpAddr(1))
+			m.handleCmd(legacyPacket(0x90, 60, 100), udpAddr(1))
+			took := time.Since(start)
+			m.Close()
+
+			if !tt.reject && took < grace {
+				t.Errorf("command handled after %v, before the grace period ended", took)
+			}
+			if tt.reject && took >= grace {
+				t.Errorf("rejecting took %v", took)
+			}
+			if got := out.Bytes(); !bytes.Equal(got, tt.want) {
+				t.Errorf("wrote % X, want % X", got, tt.want)
+			}
+			if got := conn.packets(); !reflect.DeepEqual(got, tt.replies) {
+				t.Errorf("replied %q\nwant    %q", got, tt.replies)
+			}
+			if got := d.reasons(); !reflect.DeepEqual(got, tt.drops) {
+				t.Errorf("dropped for %q, want %q", got, tt.drops)
+			}
+		})
+	}
+}
+
+func TestPing(t *testing.T) {
+	tests := []struct {
+		name string
+		req  []byte
+		want []byte
+	}{
+		{"bare", []byte(pingCall), []byte(pongReply)},
+		{"osc", oscMessage(pingCall), oscMessage(pongReply)},
+		{"payload kept", []byte(pingCall + "\x00\x00\x00,i\x00\x00\x00\x00\x30\x39"), []byte(pongReply + "\x00\x00\x00,i\x00\x00\x00\x00\x30\x39")},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			conn := &packetConn{}
+			m, out := testBridge(t, func(m *MidiBridge) { m.Conn = conn })
+			m.handleCmd(tt.req, udpAddr(1))
+			// without an address there is nobody to answer
+			m.handleCmd(tt.req, nil)
+			m.Close()
+
+			want := []sentPacket{{tt.want, udpAddr(1).String()}}
+			if got := conn.packets(); !reflect.DeepEqual(got, want) {
+				t.Errorf("replied %q, want %q", got, want)
+			}
+			if got := out.Bytes(); len(got) != 0 {
+				t.Errorf("wrote % X to midi out", got)
+			}
+		})
+	}
+}
+
+func TestNoteOffVelocityKept(t *testing.T) {
+	quiet(t)
+
+	tests := []struct {
+		name  string
+		setup func(m *MidiBridge)
+		reqs  [][]byte
+		want  []byte
+	}{
+		{
+			name: "fast path",
+			reqs: [][]byte{legacyPacket(0x80, 60, 64)},
+			want: []byte{0x80, 0x3C, 0x40},
+		},
+		{
+			name:  "decoder",
+			setup: func(m *MidiBridge) { m.Use(passThrough) },
+			reqs:  [][]byte{legacyPacket(0x80, 60, 64)},
+			want:  []byte{0x80, 0x3C, 0x40},
+		},
+		{
+			name:  "sostenuto release",
+			setup: func(m *MidiBridge) { m.Use(Sostenuto()) },
+			reqs: [][]byte{
+				legacyPacket(0x90, 60, 100),
+				legacyPacket(0xB0, sostenutoCC, 127),
+				legacyPacket(0x80, 60, 64),
+				legacyPacket(0xB0, sostenutoCC, 0),
+			},
+			want: []byte{0x90, 0x3C, 0x64, 0x80, 0x3C, 0x40},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m, out := testBridge(t, tt.setup)
+			for _, req := range tt.reqs {
+				m.handleCmd(req, nil)
+			}
+			m.Close()
+
+			if got := out.Bytes(); !bytes.Equal(got, tt.want) {
+				t.Errorf("wrote % X, want % X", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestStart(t *testing.T) {
+	tests := []struct {
+		name    string
+		in, out bool
+	}{
+		{name: "in only", in: true},
+		{name: "out only", out: true},
+		{name: "in and out", in: true, out: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			quiet(t)
+
+			flags := map[string]string{"midi-in": "", "midi-out": ""}
+			var inConns, outConns chan net.Conn
+			if tt.in {
+				var ln net.Listener
+				ln, inConns = serialServer(t)
+				flags["midi-in"] = tcpScheme + ln.Addr().String()
+			}
+			if tt.out {
+				var ln net.Listener
+				ln, outConns = serialServer(t)
+				flags["midi-out"] = tcpScheme + ln.Addr().String()
+			}
+			setFlags(t, flags)
+
+			s, err := start("127.0.0.1:0")
+			if err != nil {
+				t.Fatal(err)
+			}
+			done := make(chan struct{})
+			go func() {
+				s.run()
+				close(done)
+			}()
+			defer func() {
+				s.close()
+				<-done
+			}()
+
+			if (s.midiIn != nil) != tt.in || (s.midiOut != nil) != tt.out {
+				t.Errorf("opened in %v out %v, want in %v out %v", s.midiIn != nil, s.midiOut != nil, tt.in, tt.out)
+			}
+			// network commands need somewhere to go
+			if (s.conn != nil) != tt.out {
+				t.Fatalf("listening for commands %v, want %v", s.conn != nil, tt.out)
+			}
+
+			if tt.in {
+				accept(t, inConns).Write(rolandIdentity)
+				deadline := time.Now().Add(5 * time.Second)
+				for s.bridge.status().Identity == "" {
+					if time.Now().After(deadline) {
+						t.Fatal("midi in not read")
+					}
+					time.Sleep(time.Millisecond)
+				}
+			}
+
+			if tt.out {
+				server := accept(t, outConns)
+				client, err := net.Dial(udp, s.conn.LocalAddr().String())
+				if err != nil {
+					t.Fatal(err)
+				}
+				defer client.Close()
+				client.Write(legacyPacket(0x90, 60, 100))
+
+				got := make([]byte, 3)
+				server.SetReadDeadline(time.Now().Add(5 * time.Second))
+				if _, err := io.ReadFull(server, got); err != nil {
+					t.Fatal(err)
+				}
+				if want := []byte{0x90, 60, 100}; !bytes.Equal(got, want) {
+					t.Errorf("midi out got % X, want % X", got, want)
+				}
+			}
+		})
+	}
+}
+
+func TestStartOpenFails(t *testing.T) {
+	ln, _ := serialServer(t)
+	closed := tcpScheme + ln.Addr().String()
+	ln.Close()
+
+	for _, flags := range []map[string]string{
+		{"midi-in": closed, "midi-out": ""},
+		{"midi-in": "", "midi-out": closed},
+	} {
+		setFlags(t, flags)
+		if s, err := start("127.0.0.1:0"); err == nil {
+			s.close()
+			t.Errorf("started with %v unreachable", flags)
+		}
+	}
+}
+
+func TestStartNotifiesInOnly(t *testing.T) {
+	quiet(t)
+
+	ln, conns := serialServer(t)
+	path := tcpScheme + ln.Addr().String()
+	client, err := net.ListenPacket(udp, "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+	setFlags(t, map[string]string{"midi-in": path, "midi-out": "", "notify": client.LocalAddr().String()})
+
+	s, err := start("127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	done := make(chan struct{})
+	go func() {
+		s.run()
+		close(done)
+	}()
+	defer func() {
+		s.close()
+		<-done
+	}()
+
+	accept(t, conns).Close()
+	accept(t, conns)
+
+	client.SetReadDeadline(time.Now().Add(5 * time.Second))
+	buf := make([]byte, 1024)
+	for _, want := range [][]byte{oscMessage(disconnectedReply, path), oscMessage(connectedReply, path)} {
+		n, _, err := client.ReadFrom(buf)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(buf[:n], want) {
+			t.Errorf("notified %q, want %q", buf[:n], want)
+		}
+	}
+}
@@ -0,0 +1,90 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+)
+
+const (
+	universalRealTime = 0x7F
+	showControl       = 0x02
+	mscAllTypes       = 0x7F
+
+	MSCGo     = 0x01
+	MSCStop   = 0x02
+	MSCResume = 0x03
+)
+
+var mscCommands = map[string]byte{
+	"go":     MSCGo,
+	"stop":   MSCStop,
+	"resume": MSCResume,
+}
+
+// ShowControl is a MIDI Show Control message. Cue is the Q_number, cue
+// list and path are not kept.
+type ShowControl struct {
+	Device  byte
+	Format  byte
+	Command byte
+	Cue     string
+}
+
+// ParseShowControl decodes a MSC SysEx, msg has to include the leading
+// 0xF0 and the trailing 0xF7.
+func ParseShowControl(msg []byte) (ShowControl, bool) {
+	var sc ShowControl
+
+	if len(msg) < 7 || msg[0] != SysExC || msg[len(msg)-1] != SysExEnd ||
+		msg[1] != universalRealTime || msg[3] != showControl {
+		return sc, false
+	}
+
+	sc.Device, sc.Format, sc.Command = msg[2], msg[4], msg[5]
+
+	data := msg[6 : len(msg)-1]
+	if i := bytes.IndexByte(data, 0); i >= 0 {
+		data = data[:i]
+	}
+	sc.Cue = string(data)
+
+	return sc, true
+}
+
+// Bytes encodes sc as SysEx.
+func (sc ShowControl) Bytes() []byte {
+	buf := []byte{SysExC, universalRealTime, sc.Device, showControl, sc.Format, sc.Command}
+	buf = append(buf, sc.Cue...)
+	return append(buf, SysExEnd)
+}
+
+func (m *MidiBridge) handleShowControl(sc ShowControl) {
+	fmt.Printf("Midi Show Control: command %d cue %q\n", sc.Command, sc.Cue)
+
+	if sc.Command != MSCGo {
+		return
+	}
+	if name, ok := m.CueMacros[sc.Cue]; ok {
+		go m.playMacro(name)
+	}
+}
+
+// handleMSC sends a MSC command to all devices, the arguments are the
+// command (go, stop or resume) and an optional cue number.
+func (m *MidiBridge) handleMSC(args []string) {
+	if len(args) == 0 {
+		return
+	}
+	cmd, ok := mscCommands[strings.ToLower(args[0])]
+	if !ok {
+		fmt.Printf("msc command %s not implemeted\n", args[0])
+		return
+	}
+
+	sc := ShowControl{Device: allDevices, Format: mscAllTypes, Command: cmd}
+	if len(args) > 1 {
+		sc.Cue = args[1]
+	}
+	m.Write(sc.Bytes())
+}
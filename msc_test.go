@@ -0,0 +1,133 @@
+package main
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestParseShowControl(t *testing.T) {
+	tests := []struct {
+		name string
+		msg  []byte
+		want ShowControl
+		ok   bool
+	}{
+		{
+			name: "go with a cue",
+			msg:  []byte{0xF0, 0x7F, 0x01, 0x02, 0x01, 0x01, '1', '.', '5', 0xF7},
+			want: ShowControl{Device: 1, Format: 1, Command: MSCGo, Cue: "1.5"},
+			ok:   true,
+		},
+		{
+			name: "cue list is not kept",
+			msg:  []byte{0xF0, 0x7F, 0x7F, 0x02, 0x7F, 0x01, '3', 0x00, '2', 0xF7},
+			want: ShowControl{Device: 0x7F, Format: 0x7F, Command: MSCGo, Cue: "3"},
+			ok:   true,
+		},
+		{
+			name: "stop without a cue",
+			msg:  []byte{0xF0, 0x7F, 0x7F, 0x02, 0x7F, 0x02, 0xF7},
+			want: ShowControl{Device: 0x7F, Format: 0x7F, Command: MSCStop},
+			ok:   true,
+		},
+		{
+			name: "identity request",
+			msg:  identityRequest,
+		},
+		{
+			name: "unterminated",
+			msg:  []byte{0xF0, 0x7F, 0x01, 0x02, 0x01, 0x01, '1'},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := ParseShowControl(tt.msg)
+			if ok != tt.ok {
+				t.Fatalf("ok = %v, want %v", ok, tt.ok)
+			}
+			if !ok {
+				return
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %+v, want %+v", got, tt.want)
+			}
+			if again, _ := ParseShowControl(got.Bytes()); again != got {
+				t.Errorf("encoded and parsed again as %+v", again)
+			}
+		})
+	}
+}
+
+func TestHandleMSC(t *testing.T) {
+	quiet(t)
+
+	tests := []struct {
+		args []string
+		want []byte
+	}{
+		{[]string{"go", "12"}, []byte{0xF0, 0x7F, 0x7F, 0x02, 0x7F, 0x01, '1', '2', 0xF7}},
+		{[]string{"STOP"}, []byte{0xF0, 0x7F, 0x7F, 0x02, 0x7F, 0x02, 0xF7}},
+		{[]string{"resume", "4"}, []byte{0xF0, 0x7F, 0x7F, 0x02, 0x7F, 0x03, '4', 0xF7}},
+		{[]string{"fire", "1"}, nil},
+		{nil, nil},
+	}
+
+	for _, tt := range tests {
+		m, out := testBridge(t, nil)
+		m.handleCmd(oscMessage(mscCall, tt.args...), nil)
+		m.Close()
+
+		if got := out.Bytes(); !bytes.Equal(got, tt.want) {
+			t.Errorf("%q: wrote % X, want % X", tt.args, got, tt.want)
+		}
+	}
+}
+
+func TestCueMacros(t *testing.T) {
+	quiet(t)
+
+	m, out := testBridge(t, func(m *MidiBridge) {
+		m.CueMacros = macroMap{"3": "intro"}
+	})
+	m.handleCmd(oscMessage(recordCall, "intro"), nil)
+	m.handleCmd(legacyPacket(0x90, 60, 100), nil)
+	m.handleCmd(oscMessage(recordCall), nil)
+
+	for _, sc := range []ShowControl{
+		{Device: 1, Format: 1, Command: MSCStop, Cue: "3"},
+		{Device: 1, Format: 1, Command: MSCGo, Cue: "2"},
+		{Device: 1, Format: 1, Command: MSCGo, Cue: "3"},
+	} {
+		m.readSysEx(sc.Bytes())
+	}
+
+	want := []byte{0x90, 60, 100, 0x90, 60, 100}
+	deadline := time.Now().Add(5 * time.Second)
+	for !bytes.Equal(out.Bytes(), want) {
+		if time.Now().After(deadline) {
+			t.Fatalf("wrote % X, want % X", out.Bytes(), want)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestMacroMapSet(t *testing.T) {
+	mm := macroMap{}
+	for _, s := range []string{"1=intro", "2.5=outro", "1=verse"} {
+		if err := mm.Set(s); err != nil {
+			t.Errorf("Set(%q): %v", s, err)
+		}
+	}
+	if want := (macroMap{"1": "verse", "2.5": "outro"}); !reflect.DeepEqual(mm, want) {
+		t.Errorf("got %v, want %v", mm, want)
+	}
+
+	for _, s := range []string{"intro", "=intro", "1=", ""} {
+		if err := mm.Set(s); err == nil {
+			t.Errorf("Set(%q) succeeded", s)
+		}
+	}
+}
@@ -0,0 +1,84 @@
+package main
+
+import "fmt"
+
+const (
+	mtcSubID     = 0x01
+	mtcFullFrame = 0x01
+)
+
+var mtcRates = []string{"24", "25", "29.97", "30"}
+
+// mtcLastFrame is the highest frame number at each of mtcRates.
+var mtcLastFrame = []byte{23, 24, 29, 29}
+
+// Timecode is a MIDI Time Code position. Rate indexes mtcRates.
+type Timecode struct {
+	Rate    byte
+	Hours   byte
+	Minutes byte
+	Seconds byte
+	Frames  byte
+}
+
+func (tc Timecode) String() string {
+	return fmt.Sprintf("%02d:%02d:%02d:%02d@%s", tc.Hours, tc.Minutes, tc.Seconds, tc.Frames, mtcRates[tc.Rate])
+}
+
+// ParseFullFrame decodes a MTC full frame SysEx, msg has to include the
+// leading 0xF0 and the trailing 0xF7.
+func ParseFullFrame(msg []byte) (Timecode, bool) {
+	if len(msg) != 10 || msg[0] != SysExC || msg[9] != SysExEnd ||
+		msg[1] != universalRealTime || msg[3] != mtcSubID || msg[4] != mtcFullFrame {
+		return Timecode{}, false
+	}
+
+	return Timecode{
+		Rate:    msg[5] >> 5 & 0x03,
+		Hours:   msg[5] & 0x1f,
+		Minutes: msg[6],
+		Seconds: msg[7],
+		Frames:  msg[8],
+	}, true
+}
+
+// Bytes encodes tc as a full frame SysEx to all devices.
+func (tc Timecode) Bytes() []byte {
+	return []byte{
+		SysExC, universalRealTime, allDevices, mtcSubID, mtcFullFrame,
+		tc.Rate<<5 | tc.Hours&0x1f, tc.Minutes, tc.Seconds, tc.Frames,
+		SysExEnd,
+	}
+}
+
+// handleMTC sends a full frame locating the device, the arguments are the
+// position as hh:mm:ss:ff and optionally the frame rate, 30 if omitted.
+func (m *MidiBridge) handleMTC(args []string) {
+	if len(args) == 0 {
+		return
+	}
+
+	var tc Timecode
+	tc.Rate = 3
+	if len(args) > 1 {
+		rate := -1
+		for i, r := range mtcRates {
+			if r == args[1] {
+				rate = i
+			}
+		}
+		if rate < 0 {
+			fmt.Printf("frame rate %q not one of %v\n", args[1], mtcRates)
+			return
+		}
+		tc.Rate = byte(rate)
+	}
+
+	_, err := fmt.Sscanf(args[0], "%d:%d:%d:%d", &tc.Hours, &tc.Minutes, &tc.Seconds, &tc.Frames)
+	if err != nil || tc.Hours > 23 || tc.Minutes > 59 || tc.Seconds > 59 || tc.Frames > mtcLastFrame[tc.Rate] {
+		fmt.Printf("timecode %q not hh:mm:ss:ff at %s fps\n", args[0], mtcRates[tc.Rate])
+		return
+	}
+
+	m.Write(tc.Bytes())
+}
@@ -0,0 +1,144 @@
+package main
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+)
+
+func TestParseFullFrame(t *testing.T) {
+	tests := []struct {
+		name string
+		msg  []byte
+		want Timecode
+		ok   bool
+	}{
+		{
+			name: "30 fps",
+			msg:  []byte{0xF0, 0x7F, 0x7F, 0x01, 0x01, 0x61, 0x02, 0x03, 0x04, 0xF7},
+			want: Timecode{Rate: 3, Hours: 1, Minutes: 2, Seconds: 3, Frames: 4},
+			ok:   true,
+		},
+		{
+			name: "24 fps to one device",
+			msg:  []byte{0xF0, 0x7F, 0x05, 0x01, 0x01, 0x17, 0x3B, 0x3B, 0x17, 0xF7},
+			want: Timecode{Rate: 0, Hours: 23, Minutes: 59, Seconds: 59, Frames: 23},
+			ok:   true,
+		},
+		{
+			name: "drop frame",
+			msg:  []byte{0xF0, 0x7F, 0x7F, 0x01, 0x01, 0x4A, 0x00, 0x00, 0x00, 0xF7},
+			want: Timecode{Rate: 2, Hours: 10},
+			ok:   true,
+		},
+		{
+			name: "user bits",
+			msg:  []byte{0xF0, 0x7F, 0x7F, 0x01, 0x02, 0x00, 0x00, 0x00, 0x00, 0xF7},
+		},
+		{
+			name: "non real time",
+			msg:  []byte{0xF0, 0x7E, 0x7F, 0x01, 0x01, 0x61, 0x02, 0x03, 0x04, 0xF7},
+		},
+		{
+			name: "show control",
+			msg:  []byte{0xF0, 0x7F, 0x7F, 0x02, 0x7F, 0x01, '1', '2', '3', 0xF7},
+		},
+		{
+			name: "short",
+			msg:  []byte{0xF0, 0x7F, 0x7F, 0x01, 0x01, 0x61, 0x02, 0x03, 0xF7},
+		},
+		{
+			name: "unterminated",
+			msg:  []byte{0xF0, 0x7F, 0x7F, 0x01, 0x01, 0x61, 0x02, 0x03, 0x04, 0x05},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := ParseFullFrame(tt.msg)
+			if ok != tt.ok {
+				t.Fatalf("ok = %v, want %v", ok, tt.ok)
+			}
+			if !ok {
+				return
+			}
+			if got != tt.want {
+				t.Errorf("got %+v, want %+v", got, tt.want)
+			}
+			if again, _ := ParseFullFrame(got.Bytes()); again != got {
+				t.Errorf("encoded and parsed again as %+v", again)
+			}
+		})
+	}
+}
+
+func TestTimecodeString(t *testing.T) {
+	tests := []struct {
+		tc   Timecode
+		want string
+	}{
+		{Timecode{Rate: 3, Hours: 1, Minutes: 2, Seconds: 3, Frames: 4}, "01:02:03:04@30"},
+		{Timecode{Rate: 2, Hours: 23, Minutes: 59, Seconds: 59, Frames: 29}, "23:59:59:29@29.97"},
+		{Timecode{}, "00:00:00:00@24"},
+	}
+	for _, tt := range tests {
+		if got := tt.tc.String(); got != tt.want {
+			t.Errorf("%+v is %q, want %q", tt.tc, got, tt.want)
+		}
+	}
+}
+
+func TestHandleMTC(t *testing.T) {
+	quiet(t)
+
+	tests := []struct {
+		args []string
+		want []byte
+	}{
+		{[]string{"01:02:03:04"}, Timecode{Rate: 3, Hours: 1, Minutes: 2, Seconds: 3, Frames: 4}.Bytes()},
+		{[]string{"10:00:00:00", "25"}, Timecode{Rate: 1, Hours: 10}.Bytes()},
+		{[]string{"00:00:00:00", "29.97"}, Timecode{Rate: 2}.Bytes()},
+		{[]string{"01:02:03:04", "60"}, nil},
+		{[]string{"24:00:00:00"}, nil},
+		{[]string{"00:60:00:00"}, nil},
+		{[]string{"00:00:00:30"}, nil},
+		{[]string{"00:00:00:29"}, Timecode{Rate: 3, Frames: 29}.Bytes()},
+		{[]string{"00:00:00:23", "24"}, Timecode{Rate: 0, Frames: 23}.Bytes()},
+		{[]string{"00:00:00:27", "24"}, nil},
+		{[]string{"00:00:00:24", "25"}, Timecode{Rate: 1, Frames: 24}.Bytes()},
+		{[]string{"00:00:00:25", "25"}, nil},
+		{[]string{"00:00:00:29", "29.97"}, Timecode{Rate: 2, Frames: 29}.Bytes()},
+		{[]string{"1:2:3"}, nil},
+		{nil, nil},
+	}
+
+	for _, tt := range tests {
+		m, out := testBridge(t, nil)
+		m.handleCmd(oscMessage(mtcCall, tt.args...), nil)
+		m.Close()
+
+		if got := out.Bytes(); !bytes.Equal(got, tt.want) {
+			t.Errorf("%q: wrote % X, want % X", tt.args, got, tt.want)
+		}
+	}
+}
+
+func TestTimecodeInStatus(t *testing.T) {
+	quiet(t)
+
+	conn := &packetConn{}
+	m, _ := testBridge(t, func(m *MidiBridge) { m.Conn = conn })
+
+	m.readSysEx(Timecode{Rate: 1, Hours: 1, Minutes: 2, Seconds: 3, Frames: 4}.Bytes())
+	m.handleCmd([]byte(statusCall), udpAddr(1))
+	m.readSysEx(Timecode{Rate: 1, Hours: 1, Minutes: 2, Seconds: 4}.Bytes())
+	m.handleCmd([]byte(statusCall), udpAddr(1))
+
+	want := []sentPacket{
+		{[]byte(`{"timecode":"01:02:03:04@25"}`), udpAddr(1).String()},
+		{[]byte(`{"timecode":"01:02:04:00@25"}`), udpAddr(1).String()},
+	}
+	if got := conn.packets(); !reflect.DeepEqual(got, want) {
+		t.Errorf("replied %q\nwant    %q", got, want)
+	}
+}
@@ -0,0 +1,30 @@
+package main
+
+import "math"
+
+const (
+	minNormalizeGain = 0.5
+	maxNormalizeGain = 2
+)
+
+// Normalize evens out note on velocities over a session. It follows the
+// average velocity played, adapting by rate per note, and scales velocities
+// so that average lands on target. The gain stays within
+// minNormalizeGain and maxNormalizeGain so the dynamics survive.
+func Normalize(target, rate float64) Transform {
+	avg := target
+
+	return func(msg Midi) []Midi {
+		if !msg.isNoteOn() {
+			return []Midi{msg}
+		}
+
+		avg += (float64(msg.Velocity) - avg) * rate
+
+		gain := math.Max(minNormalizeGain, math.Min(maxNormalizeGain, target/avg))
+		v := math.Round(float64(msg.Velocity) * gain)
+		msg.Velocity = byte(math.Max(1, math.Min(127, v)))
+
+		return []Midi{msg}
+	}
+}
@@ -0,0 +1,68 @@
+package main
+
+import "testing"
+
+func TestNormalize(t *testing.T) {
+	tests := []struct {
+		name   string
+		target float64
+		rate   float64
+		steps  []transformStep
+	}{
+		{
+			name:   "follows every note at rate 1",
+			target: 64, rate: 1,
+			steps: []transformStep{
+				{noteOn(0, 60, 32), []Midi{noteOn(0, 60, 64)}},
+				{noteOn(0, 60, 100), []Midi{noteOn(0, 60, 64)}},
+				{noteOn(0, 60, 64), []Midi{noteOn(0, 60, 64)}},
+			},
+		},
+		{
+			name:   "gain is limited",
+			target: 64, rate: 1,
+			steps: []transformStep{
+				{noteOn(0, 60, 16), []Midi{noteOn(0, 60, 32)}},
+				{noteOn(0, 60, 127), []Midi{noteOn(0, 60, 64)}},
+				{noteOn(0, 60, 1), []Midi{noteOn(0, 60, 2)}},
+			},
+		},
+		{
+			name:   "dynamics survive a slow rate",
+			target: 64, rate: 0.1,
+			steps: []transformStep{
+				{noteOn(0, 60, 64), []Midi{noteOn(0, 60, 64)}},
+				{noteOn(0, 60, 100), []Midi{noteOn(0, 60, 95)}},
+				{noteOn(0, 60, 40), []Midi{noteOn(0, 60, 39)}},
+			},
+		},
+		{
+			name:   "other messages pass",
+			target: 64, rate: 1,
+			steps: []transformStep{
+				{noteOn(0, 60, 16), []Midi{noteOn(0, 60, 32)}},
+				{Midi{State: NoteOff >> 4, Note: 60, Velocity: 16}, []Midi{{State: NoteOff >> 4, Note: 60, Velocity: 16}}},
+				{noteOn(0, 60, 0), []Midi{noteOn(0, 60, 0)}},
+				{cc(0, 7, 16), []Midi{cc(0, 7, 16)}},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			runSteps(t, Normalize(tt.target, tt.rate), tt.steps)
+		})
+	}
+}
+
+func TestNormalizeConverges(t *testing.T) {
+	n := Normalize(80, 0.2)
+
+	var last Midi
+	for i := 0; i < 50; i++ {
+		last = n(noteOn(0, 60, 50))[0]
+	}
+	if last.Velocity != 80 {
+		t.Errorf("soft playing ends at velocity %d, want 80", last.Velocity)
+	}
+}
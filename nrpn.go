@@ -0,0 +1,124 @@
+package main
+
+import "sync"
+
+const (
+	dataEntryCC    = 6
+	dataEntryLSBCC = 38
+	dataIncCC      = 96
+	dataDecCC      = 97
+	nrpnLSBCC      = 98
+	nrpnMSBCC      = 99
+	rpnLSBCC       = 100
+	rpnMSBCC       = 101
+)
+
+// nrpnGroups collects NRPN and RPN edits, the parameter number followed by
+// data entry, into one run of bytes per edit. Written as one, nothing gets
+// between the controllers and none of them is thinned or dropped alone.
+type nrpnGroups struct {
+	mu sync.Mutex
+	// lsb waits for data entry LSB before an edit is complete
+	lsb     bool
+	pending [16][]byte
+}
+
+func newNRPNGroups(lsb bool) *nrpnGroups {
+	return &nrpnGroups{lsb: lsb}
+}
+
+func nrpnCC(cc byte) bool {
+	switch cc {
+	case dataEntryCC, dataEntryLSBCC, dataIncCC, dataDecCC,
+		nrpnLSBCC, nrpnMSBCC, rpnLSBCC, rpnMSBCC:
+		return true
+	}
+	return false
+}
+
+// partner is the other half of a parameter number controller.
+func partner(cc byte) byte {
+	switch cc {
+	case nrpnMSBCC:
+		return nrpnLSBCC
+	case nrpnLSBCC:
+		return nrpnMSBCC
+	case rpnMSBCC:
+		return rpnLSBCC
+	case rpnLSBCC:
+		return rpnMSBCC
+	}
+	return cc
+}
+
+// rpnNull reports whether pending is RPN 127/127, which deselects the
+// parameter and is not followed by data entry.
+func rpnNull(pending []byte) bool {
+	return len(pending) == 6 &&
+		(pending[1] == rpnMSBCC || pending[1] == rpnLSBCC) &&
+		pending[2] == 0x7f && pending[5] == 0x7f
+}
+
+// collect takes data written to midi out. It returns what is to be written
+// now: data itself, nothing while an edit is incomplete, or the complete
+// edit. A parameter number replacing an incomplete edit is returned as
+// dropped.
+func (g *nrpnGroups) collect(data []byte) (out, dropped []byte) {
+	if len(data) != 3 || data[0]&0xf0 != ContinuousContr || !nrpnCC(data[1]) {
+		return data, nil
+	}
+
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	ch := data[0] & 0x0f
+	pending := g.pending[ch]
+
+	switch data[1] {
+	case nrpnMSBCC, nrpnLSBCC, rpnMSBCC, rpnLSBCC:
+		// the parameter number comes MSB or LSB first, anything else
+		// before it is an edit never completed
+		if len(pending) != 3 || pending[1] != partner(data[1]) {
+			dropped, pending = pending, nil
+		}
+		pending = append(pending, data...)
+		if rpnNull(pending) {
+			g.pending[ch] = nil
+			return pending, dropped
+		}
+		g.pending[ch] = pending
+		return nil, dropped
+
+	case dataEntryCC:
+		if pending == nil {
+			return data, nil
+		}
+		waiting := pending[len(pending)-2] == dataEntryCC
+		pending = append(pending, data...)
+		if g.lsb && !waiting {
+			g.pending[ch] = pending
+			return nil, nil
+		}
+
+	case dataEntryLSBCC:
+		if pending == nil || pending[len(pending)-2] != dataEntryCC {
+			return data, nil
+		}
+		pending = append(pending, data...)
+
+	case dataIncCC, dataDecCC:
+		if pending == nil {
+			return data, nil
+		}
+		pending = append(pending, data...)
+	}
+
+	g.pending[ch] = nil
+	return pending, nil
+}
+
+// nrpnGroup reports whether data is an edit collected by nrpnGroups
+// rather than a single message.
+func nrpnGroup(data []byte) bool {
+	return len(data) > 3 && data[0]&0xf0 == ContinuousContr
+}
@@ -0,0 +1,143 @@
+package main
+
+import (
+	"bytes"
+	"testing"
+	"time"
+)
+
+func TestNRPNCollect(t *testing.T) {
+	tests := []struct {
+		name    string
+		lsb     bool
+		in      [][]byte
+		out     [][]byte
+		dropped [][]byte
+	}{
+		{
+			name: "nrpn msb first",
+			in:   [][]byte{{0xB0, 99, 1}, {0xB0, 98, 2}, {0xB0, 6, 64}},
+			out:  [][]byte{{0xB0, 99, 1, 0xB0, 98, 2, 0xB0, 6, 64}},
+		},
+		{
+			name: "nrpn lsb first",
+			in:   [][]byte{{0xB1, 98, 2}, {0xB1, 99, 1}, {0xB1, 6, 64}},
+			out:  [][]byte{{0xB1, 98, 2, 0xB1, 99, 1, 0xB1, 6, 64}},
+		},
+		{
+			name: "rpn with data entry lsb",
+			lsb:  true,
+			in:   [][]byte{{0xB0, 101, 0}, {0xB0, 100, 0}, {0xB0, 6, 2}, {0xB0, 38, 0}},
+			out:  [][]byte{{0xB0, 101, 0, 0xB0, 100, 0, 0xB0, 6, 2, 0xB0, 38, 0}},
+		},
+		{
+			name: "increment",
+			in:   [][]byte{{0xB0, 101, 0}, {0xB0, 100, 0}, {0xB0, 96, 0}},
+			out:  [][]byte{{0xB0, 101, 0, 0xB0, 100, 0, 0xB0, 96, 0}},
+		},
+		{
+			name: "rpn null passes at once",
+			in:   [][]byte{{0xB0, 101, 127}, {0xB0, 100, 127}},
+			out:  [][]byte{{0xB0, 101, 127, 0xB0, 100, 127}},
+		},
+		{
+			name: "rpn null lsb first",
+			in:   [][]byte{{0xB0, 100, 127}, {0xB0, 101, 127}},
+			out:  [][]byte{{0xB0, 100, 127, 0xB0, 101, 127}},
+		},
+		{
+			name:    "incomplete edit is dropped",
+			in:      [][]byte{{0xB0, 99, 1}, {0xB0, 98, 2}, {0xB0, 99, 3}, {0xB0, 98, 4}, {0xB0, 6, 5}},
+			out:     [][]byte{{0xB0, 99, 3, 0xB0, 98, 4, 0xB0, 6, 5}},
+			dropped: [][]byte{{0xB0, 99, 1, 0xB0, 98, 2}},
+		},
+		{
+			name: "other controllers pass",
+			in:   [][]byte{{0xB0, 99, 1}, {0xB0, 7, 100}, {0xB2, 6, 1}, {0xB0, 98, 2}, {0xB0, 6, 64}},
+			out:  [][]byte{{0xB0, 7, 100}, {0xB2, 6, 1}, {0xB0, 99, 1, 0xB0, 98, 2, 0xB0, 6, 64}},
+		},
+		{
+			name: "edits on two channels",
+			in:   [][]byte{{0xB0, 99, 1}, {0xB1, 99, 9}, {0xB0, 98, 2}, {0xB1, 98, 8}, {0xB1, 6, 7}, {0xB0, 6, 3}},
+			out:  [][]byte{{0xB1, 99, 9, 0xB1, 98, 8, 0xB1, 6, 7}, {0xB0, 99, 1, 0xB0, 98, 2, 0xB0, 6, 3}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g := newNRPNGroups(tt.lsb)
+
+			var out, dropped [][]byte
+			for _, data := range tt.in {
+				o, d := g.collect(data)
+				if o != nil {
+					out = append(out, o)
+				}
+				if d != nil {
+					dropped = append(dropped, d)
+				}
+			}
+
+			if !equalRuns(out, tt.out) {
+				t.Errorf("out % X, want % X", out, tt.out)
+			}
+			if !equalRuns(dropped, tt.dropped) {
+				t.Errorf("dropped % X, want % X", dropped, tt.dropped)
+			}
+		})
+	}
+}
+
+func equalRuns(a, b [][]byte) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if !bytes.Equal(a[i], b[i]) {
+			return false
+		}
+	}
+	return true
+}
+
+// Two edits of the same parameter, interleaved with other traffic, sent
+// by two clients while the queue is congested. Thinning and collapsing
+// would tear them apart if they were single controllers.
+func TestNRPNSurvivesThinAndCollapse(t *testing.T) {
+	m, out := testBridge(t, func(m *MidiBridge) {
+		m.Thin = 1
+		m.Delay = 20 * time.Millisecond
+		m.CollapseCC = time.Second
+		m.NRPN = newNRPNGroups(false)
+	})
+
+	packets := []struct {
+		port    int
+		status  byte
+		control byte
+		value   byte
+	}{
+		{1, 0xB0, 99, 1},
+		{1, 0xB0, 98, 2},
+		{1, 0xB0, 7, 90},
+		{1, 0xB0, 6, 10},
+		{2, 0xB0, 99, 1},
+		{2, 0xB0, 98, 2},
+		{2, 0xB0, 7, 100},
+		{2, 0xB0, 6, 20},
+	}
+	for _, p := range packets {
+		m.handleBridgeIn(legacyCodec{}, legacyPacket(p.status, p.control, p.value), udpAddr(p.port))
+	}
+	m.Close()
+
+	want := []byte{
+		0xB0, 99, 1, 0xB0, 98, 2, 0xB0, 6, 10,
+		// the plain controller is thinned to its last value
+		0xB0, 7, 100,
+		0xB0, 99, 1, 0xB0, 98, 2, 0xB0, 6, 20,
+	}
+	if got := out.Bytes(); !bytes.Equal(got, want) {
+		t.Errorf("wrote % X\nwant  % X", got, want)
+	}
+}
@@ -0,0 +1,67 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+)
+
+// oscMessage frames address and string arguments as an OSC message.
+func oscMessage(address string, args ...string) []byte {
+	buf := oscPad([]byte(address))
+	buf = append(buf, oscPad([]byte(","+strings.Repeat("s", len(args))))...)
+	for _, arg := range args {
+		buf = append(buf, oscPad([]byte(arg))...)
+	}
+	return buf
+}
+
+// oscPad terminates s and pads it to a multiple of four bytes.
+func oscPad(s []byte) []byte {
+	buf := append(s, 0)
+	for len(buf)%4 != 0 {
+		buf = append(buf, 0)
+	}
+	return buf
+}
+
+// oscString reads a padded OSC string off the front of buf.
+func oscString(buf []byte) (string, []byte, bool) {
+	end := bytes.IndexByte(buf, 0)
+	if end < 0 {
+		return "", nil, false
+	}
+	s := string(buf[:end])
+
+	next := (end + 4) &^ 3
+	if next > len(buf) {
+		next = len(buf)
+	}
+	return s, buf[next:], true
+}
+
+// oscStrings returns the leading string arguments of the OSC message req,
+// it stops at the first argument of another type.
+func oscStrings(req []byte) []string {
+	_, rest, ok := oscString(req)
+	if !ok {
+		return nil
+	}
+	tags, rest, ok := oscString(rest)
+	if !ok || len(tags) == 0 || tags[0] != ',' {
+		return nil
+	}
+
+	var args []string
+	for _, tag := range tags[1:] {
+		if tag != 's' {
+			break
+		}
+		var arg string
+		arg, rest, ok = oscString(rest)
+		if !ok {
+			break
+		}
+		args = append(args, arg)
+	}
+	return args
+}
@@ -0,0 +1,47 @@
+package main
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+)
+
+func TestOSCMessage(t *testing.T) {
+	tests := []struct {
+		address string
+		args    []string
+		want    []byte
+	}{
+		{"/hold", nil, []byte("/hold\x00\x00\x00,\x00\x00\x00")},
+		{"/mtc", []string{"01:02:03:04"}, []byte("/mtc\x00\x00\x00\x00,s\x00\x0001:02:03:04\x00")},
+		{"/drone", []string{"60", "3"}, []byte("/drone\x00\x00,ss\x0060\x00\x003\x00\x00\x00")},
+	}
+	for _, tt := range tests {
+		got := oscMessage(tt.address, tt.args...)
+		if !bytes.Equal(got, tt.want) {
+			t.Errorf("oscMessage(%q, %q) = %q, want %q", tt.address, tt.args, got, tt.want)
+		}
+		if args := oscStrings(got); !reflect.DeepEqual(args, tt.args) {
+			t.Errorf("read back %q, want %q", args, tt.args)
+		}
+	}
+}
+
+func TestOSCStrings(t *testing.T) {
+	tests := []struct {
+		name string
+		req  []byte
+		want []string
+	}{
+		{"no type tags", []byte("/record\x00"), nil},
+		{"address only", []byte("/record"), nil},
+		{"stops at other types", []byte("/x\x00\x00,sis\x00\x00\x00\x00a\x00\x00\x00\x00\x00\x00\x01b\x00\x00\x00"), []string{"a"}},
+		{"truncated argument", []byte("/x\x00\x00,ss\x00a\x00\x00\x00b"), []string{"a"}},
+		{"unpadded last argument", []byte("/x\x00\x00,s\x00\x00intro\x00"), []string{"intro"}},
+	}
+	for _, tt := range tests {
+		if got := oscStrings(tt.req); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s: got %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,138 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	sustainCC     = 64
+	allNotesOffCC = 123
+)
+
+// panicMessages releases the sustain pedal and sends All Notes Off on every
+// channel.
+func panicMessages() []Midi {
+	var out []Midi
+	for ch := byte(0); ch < 16; ch++ {
+		out = append(out,
+			Midi{State: ContinuousContr >> 4, Channel: ch, Note: sustainCC},
+			Midi{State: ContinuousContr >> 4, Channel: ch, Note: allNotesOffCC},
+		)
+	}
+	return out
+}
+
+// chord is a flag.Value holding a comma separated list of notes.
+type chord []byte
+
+func (c *chord) String() string {
+	var s []string
+	for _, n := range *c {
+		s = append(s, strconv.Itoa(int(n)))
+	}
+	return strings.Join(s, ",")
+}
+
+func (c *chord) Set(s string) error {
+	*c = nil
+	for _, f := range strings.Split(s, ",") {
+		n, err := strconv.Atoi(strings.TrimSpace(f))
+		if err != nil || n < 0 || n > 127 {
+			return fmt.Errorf("note %q out of range [0-127]", f)
+		}
+		*c = append(*c, byte(n))
+	}
+	return nil
+}
+
+// PanicChord sends a panic once all notes of c are pressed within window
+// on any one channel, or when controller cc goes on, cc < 0 disables the
+// controller. Note ons of the chord are held back for window, so the notes
+// of a completed chord are swallowed along with their note offs. A held
+// note that doesn't complete the chord is released when its window runs
+// out, or right away with its note off.
+//
+// Held notes are released from a timer, which calls flush with a function
+// handing them over. flush has to call it under the lock the transform
+// runs under and send the notes on.
+func PanicChord(c chord, window time.Duration, cc int, flush func(pop func() []Midi)) Transform {
+	inChord := map[byte]bool{}
+	for _, n := range c {
+		inChord[n] = true
+	}
+	type heldOn struct {
+		msg Midi
+		at  time.Time
+	}
+	held := map[noteKey]heldOn{}
+	swallow := map[noteKey]bool{}
+
+	return func(msg Midi) []Midi {
+		switch {
+		case cc >= 0 && msg.isCC(byte(cc)):
+			if msg.Velocity >= 64 {
+				return panicMessages()
+			}
+			return nil
+
+		case len(c) == 0 || !inChord[msg.Note]:
+
+		case msg.isNoteOn():
+			k := msg.key()
+			var out []Midi
+			if on, ok := held[k]; ok {
+				// pressed again, the first strike sounds
+				out = append(out, on.msg)
+			}
+			held[k] = heldOn{msg, time.Now()}
+
+			for _, n := range c {
+				if _, ok := held[noteKey{msg.Channel, n}]; !ok {
+					time.AfterFunc(window, func() {
+						flush(func() []Midi {
+							// every note due, in the order they were pressed
+							var due []heldOn
+							for k, on := range held {
+								if time.Since(on.at) >= window {
+									due = append(due, on)
+									delete(held, k)
+								}
+							}
+							sort.Slice(due, func(i, j int) bool { return due[i].at.Before(due[j].at) })
+
+							var out []Midi
+							for _, on := range due {
+								out = append(out, on.msg)
+							}
+							return out
+						})
+					})
+					return out
+				}
+			}
+
+			for _, n := range c {
+				k := noteKey{msg.Channel, n}
+				delete(held, k)
+				swallow[k] = true
+			}
+			return append(out, panicMessages()...)
+
+		case msg.isNoteOff():
+			if swallow[msg.key()] {
+				delete(swallow, msg.key())
+				return nil
+			}
+			if on, ok := held[msg.key()]; ok {
+				delete(held, msg.key())
+				return []Midi{on.msg, msg}
+			}
+		}
+
+		return []Midi{msg}
+	}
+}
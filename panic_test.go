@@ -0,0 +1,161 @@
+package main
+
+import (
+	"bytes"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestPanicChord(t *testing.T) {
+	silence := panicMessages()
+
+	type step struct {
+		wait time.Duration
+		in   Midi
+		want []Midi
+	}
+	tests := []struct {
+		name     string
+		chord    chord
+		cc       int
+		steps    []step
+		released []Midi
+	}{
+		{
+			name:  "chord sends panic",
+			chord: chord{0, 1, 2},
+			cc:    -1,
+			steps: []step{
+				{in: noteOn(0, 0, 100)},
+				{in: noteOn(0, 5, 100), want: []Midi{noteOn(0, 5, 100)}},
+				{in: noteOn(0, 1, 100)},
+				{in: noteOn(0, 2, 100), want: silence},
+				{in: noteOff(0, 0)},
+				{in: noteOff(0, 1)},
+				{in: noteOff(0, 2)},
+				{in: noteOn(0, 0, 100)},
+			},
+			released: []Midi{noteOn(0, 0, 100)},
+		},
+		{
+			name:  "too slow",
+			chord: chord{0, 1},
+			cc:    -1,
+			steps: []step{
+				{in: noteOn(0, 0, 100)},
+				{wait: 30 * time.Millisecond, in: noteOn(0, 1, 100)},
+				{in: noteOff(0, 0), want: []Midi{noteOff(0, 0)}},
+			},
+			released: []Midi{noteOn(0, 0, 100), noteOn(0, 1, 100)},
+		},
+		{
+			name:  "chord split over channels",
+			chord: chord{0, 1},
+			cc:    -1,
+			steps: []step{
+				{in: noteOn(0, 0, 100)},
+				{in: noteOn(1, 1, 100)},
+			},
+			released: []Midi{noteOn(0, 0, 100), noteOn(1, 1, 100)},
+		},
+		{
+			name:  "released before completed",
+			chord: chord{0, 1},
+			cc:    -1,
+			steps: []step{
+				{in: noteOn(0, 0, 100)},
+				{in: noteOff(0, 0), want: []Midi{noteOn(0, 0, 100), noteOff(0, 0)}},
+				{in: noteOn(0, 1, 100)},
+			},
+			released: []Midi{noteOn(0, 1, 100)},
+		},
+		{
+			name:  "pressed again",
+			chord: chord{0, 1},
+			cc:    -1,
+			steps: []step{
+				{in: noteOn(0, 0, 100)},
+				{in: noteOn(0, 0, 90), want: []Midi{noteOn(0, 0, 100)}},
+			},
+			released: []Midi{noteOn(0, 0, 90)},
+		},
+		{
+			name: "controller",
+			cc:   20,
+			steps: []step{
+				{in: cc(0, 20, 127), want: silence},
+				{in: cc(0, 20, 0)},
+				{in: cc(0, 21, 127), want: []Midi{cc(0, 21, 127)}},
+				{in: noteOn(0, 0, 100), want: []Midi{noteOn(0, 0, 100)}},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// the lock the pipeline runs under
+			var mu sync.Mutex
+			var released []Midi
+			tr := PanicChord(tt.chord, 10*time.Millisecond, tt.cc, func(pop func() []Midi) {
+				mu.Lock()
+				defer mu.Unlock()
+				released = append(released, pop()...)
+			})
+
+			for i, s := range tt.steps {
+				time.Sleep(s.wait)
+				mu.Lock()
+				got := tr(s.in)
+				mu.Unlock()
+				if !reflect.DeepEqual(got, s.want) {
+					t.Errorf("step %d: got %+v, want %+v", i, got, s.want)
+				}
+			}
+
+			time.Sleep(30 * time.Millisecond)
+			mu.Lock()
+			defer mu.Unlock()
+			if !reflect.DeepEqual(released, tt.released) {
+				t.Errorf("released %+v, want %+v", released, tt.released)
+			}
+		})
+	}
+}
+
+func TestPanicChordRelease(t *testing.T) {
+	quiet(t)
+
+	// the transforms after the chord see the released note
+	configs := profiles{}
+	if err := configs.Set("pad=-panic-chord 60,64 -panic-window 10ms -note-cc 0:60:20:momentary"); err != nil {
+		t.Fatal(err)
+	}
+	m, out := testBridge(t, func(m *MidiBridge) {
+		m.transforms = configs["pad"].transforms(m.release)
+	})
+
+	m.handleCmd(legacyPacket(0x90, 60, 100), nil)
+	time.Sleep(30 * time.Millisecond)
+	m.handleCmd(legacyPacket(0x80, 60, 0), nil)
+	m.Close()
+
+	want := []byte{0xB0, 20, 127, 0xB0, 20, 0}
+	if got := out.Bytes(); !bytes.Equal(got, want) {
+		t.Errorf("wrote % X, want % X", got, want)
+	}
+}
+
+func TestPanicMessages(t *testing.T) {
+	msgs := panicMessages()
+	if len(msgs) != 32 {
+		t.Fatalf("%d messages, want sustain off and all notes off on 16 channels", len(msgs))
+	}
+	for ch := byte(0); ch < 16; ch++ {
+		want := []Midi{cc(ch, sustainCC, 0), cc(ch, allNotesOffCC, 0)}
+		if got := msgs[2*ch : 2*ch+2]; !reflect.DeepEqual(got, want) {
+			t.Errorf("channel %d: %+v, want %+v", ch, got, want)
+		}
+	}
+}
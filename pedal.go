@@ -0,0 +1,90 @@
+package main
+
+const (
+	sostenutoCC = 66
+	softPedalCC = 67
+)
+
+func pedalDown(msg Midi) bool {
+	return msg.Velocity >= 64
+}
+
+// Sostenuto emulates the sostenuto pedal for devices without it. Engaging
+// the pedal holds only the notes already down at that moment, notes played
+// while it is down are not held. The pedal itself is not forwarded.
+func Sostenuto() Transform {
+	held := map[noteKey]bool{}
+	sustained := map[noteKey]bool{}
+	released := map[noteKey]Midi{}
+	var pedal [16]bool
+
+	return func(msg Midi) []Midi {
+		switch {
+		case msg.isNoteOn():
+			held[msg.key()] = true
+			delete(released, msg.key())
+
+		case msg.isNoteOff():
+			delete(held, msg.key())
+			if pedal[msg.Channel] && sustained[msg.key()] {
+				released[msg.key()] = msg
+				return nil
+			}
+
+		case msg.isCC(sostenutoCC):
+			ch := msg.Channel
+			switch {
+			case pedalDown(msg) && !pedal[ch]:
+				pedal[ch] = true
+				for k := range held {
+					if k.Channel == ch {
+						sustained[k] = true
+					}
+				}
+			case !pedalDown(msg) && pedal[ch]:
+				pedal[ch] = false
+				var out []Midi
+				for k := range sustained {
+					if k.Channel != ch {
+						continue
+					}
+					delete(sustained, k)
+					if off, ok := released[k]; ok {
+						out = append(out, off)
+						delete(released, k)
+					}
+				}
+				return out
+			}
+			return nil
+		}
+
+		return []Midi{msg}
+	}
+}
+
+// SoftPedal scales note on velocities by factor while the soft pedal is
+// down. The pedal itself is not forwarded.
+func SoftPedal(factor float64) Transform {
+	var pedal [16]bool
+
+	return func(msg Midi) []Midi {
+		switch {
+		case msg.isCC(softPedalCC):
+			pedal[msg.Channel] = pedalDown(msg)
+			return nil
+
+		case msg.isNoteOn() && pedal[msg.Channel]:
+			v := int(float64(msg.Velocity) * factor)
+			if v < 1 {
+				v = 1
+			}
+			if v > 127 {
+				v = 127
+			}
+			msg.Velocity = byte(v)
+		}
+
+		return []Midi{msg}
+	}
+}
@@ -0,0 +1,107 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+// transformStep is a message fed to a transform and what comes out.
+type transformStep struct {
+	in   Midi
+	want []Midi
+}
+
+func runSteps(t *testing.T, tr Transform, steps []transformStep) {
+	t.Helper()
+
+	for i, s := range steps {
+		got := tr(s.in)
+		if len(got) == 0 && len(s.want) == 0 {
+			continue
+		}
+		if !reflect.DeepEqual(got, s.want) {
+			t.Errorf("step %d %+v: got %+v, want %+v", i, s.in, got, s.want)
+		}
+	}
+}
+
+func TestSostenuto(t *testing.T) {
+	tests := []struct {
+		name  string
+		steps []transformStep
+	}{
+		{
+			name: "holds notes down when pressed",
+			steps: []transformStep{
+				{noteOn(0, 60, 100), []Midi{noteOn(0, 60, 100)}},
+				{cc(0, sostenutoCC, 127), nil},
+				{noteOff(0, 60), nil},
+				{cc(0, sostenutoCC, 0), []Midi{noteOff(0, 60)}},
+			},
+		},
+		{
+			name: "notes played while down are not held",
+			steps: []transformStep{
+				{cc(0, sostenutoCC, 127), nil},
+				{noteOn(0, 62, 100), []Midi{noteOn(0, 62, 100)}},
+				{noteOff(0, 62), []Midi{noteOff(0, 62)}},
+				{cc(0, sostenutoCC, 0), nil},
+			},
+		},
+		{
+			name: "note still down on release keeps sounding",
+			steps: []transformStep{
+				{noteOn(0, 60, 100), []Midi{noteOn(0, 60, 100)}},
+				{cc(0, sostenutoCC, 127), nil},
+				{cc(0, sostenutoCC, 0), nil},
+				{noteOff(0, 60), []Midi{noteOff(0, 60)}},
+			},
+		},
+		{
+			name: "restruck note is not released twice",
+			steps: []transformStep{
+				{noteOn(0, 60, 100), []Midi{noteOn(0, 60, 100)}},
+				{cc(0, sostenutoCC, 127), nil},
+				{noteOff(0, 60), nil},
+				{noteOn(0, 60, 90), []Midi{noteOn(0, 60, 90)}},
+				{cc(0, sostenutoCC, 0), nil},
+			},
+		},
+		{
+			name: "channels are independent",
+			steps: []transformStep{
+				{noteOn(0, 60, 100), []Midi{noteOn(0, 60, 100)}},
+				{noteOn(1, 60, 100), []Midi{noteOn(1, 60, 100)}},
+				{cc(0, sostenutoCC, 127), nil},
+				{noteOff(1, 60), []Midi{noteOff(1, 60)}},
+				{noteOff(0, 60), nil},
+				{cc(1, sostenutoCC, 0), nil},
+				{cc(0, sostenutoCC, 0), []Midi{noteOff(0, 60)}},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			runSteps(t, Sostenuto(), tt.steps)
+		})
+	}
+}
+
+func TestSoftPedal(t *testing.T) {
+	runSteps(t, SoftPedal(0.5), []transformStep{
+		{noteOn(0, 60, 100), []Midi{noteOn(0, 60, 100)}},
+		{cc(0, softPedalCC, 127), nil},
+		{noteOn(0, 62, 100), []Midi{noteOn(0, 62, 50)}},
+		{noteOn(0, 64, 1), []Midi{noteOn(0, 64, 1)}},
+		{noteOn(1, 60, 100), []Midi{noteOn(1, 60, 100)}},
+		{noteOff(0, 62), []Midi{noteOff(0, 62)}},
+		{cc(0, softPedalCC, 0), nil},
+		{noteOn(0, 62, 100), []Midi{noteOn(0, 62, 100)}},
+	})
+
+	runSteps(t, SoftPedal(2), []transformStep{
+		{cc(0, softPedalCC, 64), nil},
+		{noteOn(0, 60, 100), []Midi{noteOn(0, 60, 127)}},
+	})
+}
@@ -0,0 +1,244 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"time"
+)
+
+// pipelineFlags configure the transform pipeline. The command line holds
+// one set, every profile another.
+type pipelineFlags struct {
+	ccToPitchBend *int
+	pitchBendToCC *int
+
+	bendCenter      *int
+	bendCenterLearn *bool
+
+	aftertouchToCC    *int
+	aftertouchCCScale *float64
+
+	panicNotes  chord
+	panicWindow *time.Duration
+	panicCC     *int
+
+	noteCCs noteTriggers
+
+	transposeCC      *int
+	transposeRange   *int
+	transposeRelease *bool
+
+	sostenuto *bool
+	softPedal *float64
+
+	normalize     *int
+	normalizeRate *float64
+
+	gateCC *int
+}
+
+func newPipelineFlags(fs *flag.FlagSet) *pipelineFlags {
+	p := &pipelineFlags{
+		ccToPitchBend: fs.Int("cc-to-pitchbend", -1, "controller number to convert into pitch bend [0-127]"),
+		pitchBendToCC: fs.Int("pitchbend-to-cc", -1, "controller number to convert pitch bend into [0-127]"),
+
+		bendCenter:      fs.Int("bend-center", -1, "pitch bend value the wheel rests at, recentered to 8192 [1-16382, -1 disables]"),
+		bendCenterLearn: fs.Bool("bend-center-learn", false, "learn the resting pitch bend value per channel from the first bend near the center, instead of -bend-center"),
+
+		aftertouchToCC:    fs.Int("aftertouch-to-cc", -1, "controller number to convert channel pressure and poly aftertouch into [0-127]"),
+		aftertouchCCScale: fs.Float64("aftertouch-scale", 1, "scale aftertouch pressure by this factor when converting it"),
+
+		panicWindow: fs.Duration("panic-window", 50*time.Millisecond, "time within which all notes of the panic chord have to be pressed"),
+		panicCC:     fs.Int("panic-cc", -1, "controller number that sends All Notes Off when switched on [0-127]"),
+
+		transposeCC:      fs.Int("transpose-cc", -1, "controller number that sets the transpose amount live [0-127]"),
+		transposeRange:   fs.Int("transpose-range", 24, "semitones the transpose controller sweeps in either direction"),
+		transposeRelease: fs.Bool("transpose-release", false, "release held notes when the transpose amount changes"),
+
+		sostenuto: fs.Bool("sostenuto", false, "emulate the sostenuto pedal (cc 66)"),
+		softPedal: fs.Float64("soft-pedal", 0, "scale note on velocity by this factor while the soft pedal (cc 67) is down [0 disables]"),
+
+		normalize:     fs.Int("normalize", 0, "even out note velocities towards this average [1-127, 0 disables]"),
+		normalizeRate: fs.Float64("normalize-rate", 0.02, "how fast -normalize follows the velocities played [0-1]"),
+
+		gateCC: fs.Int("gate-cc", -1, "controller number that mutes the output while it is down, e.g. a footswitch [0-127]"),
+	}
+
+	fs.Var(&p.noteCCs, "note-cc", "send a controller for a pad, channel:note:cc:mode[:value] with mode set, toggle or momentary (repeatable)")
+	fs.Var(&p.panicNotes, "panic-chord", "comma separated notes that send All Notes Off when pressed together, their note ons are held back for -panic-window and swallowed when the chord completes")
+
+	return p
+}
+
+func (p *pipelineFlags) validate() []error {
+	var errs []error
+
+	controllers := []struct {
+		name string
+		cc   int
+	}{
+		{"cc-to-pitchbend", *p.ccToPitchBend},
+		{"pitchbend-to-cc", *p.pitchBendToCC},
+		{"aftertouch-to-cc", *p.aftertouchToCC},
+		{"transpose-cc", *p.transposeCC},
+		{"panic-cc", *p.panicCC},
+		{"gate-cc", *p.gateCC},
+	}
+	for _, c := range controllers {
+		if c.cc < -1 || c.cc > 127 {
+			errs = append(errs, fmt.Errorf("-%s: controller %d out of range [0-127]", c.name, c.cc))
+		}
+	}
+
+	if c := *p.bendCenter; c != -1 && (c < 1 || c > maxPitchBend-1) {
+		errs = append(errs, fmt.Errorf("-bend-center: %d out of range [1-16382]", c))
+	}
+
+	if *p.aftertouchCCScale < 0 {
+		errs = append(errs, fmt.Errorf("-aftertouch-scale: factor %g is negative", *p.aftertouchCCScale))
+	}
+
+	if *p.transposeRange < 0 || *p.transposeRange > 127 {
+		errs = append(errs, fmt.Errorf("-transpose-range: %d semitones out of range [0-127]", *p.transposeRange))
+	}
+
+	if *p.normalize < 0 || *p.normalize > 127 {
+		errs = append(errs, fmt.Errorf("-normalize: velocity %d out of range [0-127]", *p.normalize))
+	}
+	if *p.normalizeRate <= 0 || *p.normalizeRate > 1 {
+		errs = append(errs, fmt.Errorf("-normalize-rate: %g out of range (0-1]", *p.normalizeRate))
+	}
+
+	if *p.softPedal < 0 {
+		errs = append(errs, fmt.Errorf("-soft-pedal: velocity factor %g is negative", *p.softPedal))
+	}
+
+	return errs
+}
+
+// transforms builds a fresh pipeline, transforms keep state so every
+// pipeline needs its own. Notes a transform holds back are released
+// through release with the transforms after it.
+func (p *pipelineFlags) transforms(release func(rest []Transform, pop func() []Midi)) []Transform {
+	var ts []Transform
+
+	// recenter first, the conversions rely on the bend center
+	if *p.bendCenter >= 0 || *p.bendCenterLearn {
+		ts = append(ts, BendCenter(*p.bendCenter, *p.bendCenterLearn))
+	}
+
+	switch {
+	case *p.ccToPitchBend >= 0 && *p.pitchBendToCC >= 0:
+		// convert in a single step, otherwise converted messages would be
+		// converted right back
+		toBend := CCToPitchBend(byte(*p.ccToPitchBend))
+		toCC := PitchBendToCC(byte(*p.pitchBendToCC))
+		ts = append(ts, func(msg Midi) []Midi {
+			if msg.Command() == PitchBend {
+				return toCC(msg)
+			}
+			return toBend(msg)
+		})
+	case *p.ccToPitchBend >= 0:
+		ts = append(ts, CCToPitchBend(byte(*p.ccToPitchBend)))
+	case *p.pitchBendToCC >= 0:
+		ts = append(ts, PitchBendToCC(byte(*p.pitchBendToCC)))
+	}
+
+	if *p.aftertouchToCC >= 0 {
+		ts = append(ts, AftertouchToCC(byte(*p.aftertouchToCC), *p.aftertouchCCScale))
+	}
+
+	if len(p.panicNotes) > 0 || *p.panicCC >= 0 {
+		i := len(ts)
+		// ts is complete by the time a held note is released
+		ts = append(ts, PanicChord(p.panicNotes, *p.panicWindow, *p.panicCC, func(pop func() []Midi) {
+			release(ts[i+1:], pop)
+		}))
+	}
+
+	if len(p.noteCCs) > 0 {
+		ts = append(ts, NoteToCC(p.noteCCs))
+	}
+
+	if *p.transposeCC >= 0 {
+		ts = append(ts, Transpose(byte(*p.transposeCC), *p.transposeRange, *p.transposeRelease))
+	}
+
+	if *p.sostenuto {
+		ts = append(ts, Sostenuto())
+	}
+	if *p.softPedal > 0 {
+		ts = append(ts, SoftPedal(*p.softPedal))
+	}
+
+	if *p.normalize > 0 {
+		ts = append(ts, Normalize(float64(*p.normalize), *p.normalizeRate))
+	}
+
+	// last, so it mutes what the other transforms make of the input
+	if *p.gateCC >= 0 {
+		ts = append(ts, Gate(byte(*p.gateCC)))
+	}
+
+	return ts
+}
+
+// profiles is a flag.Value collecting name=flags profiles, flags are
+// pipeline flags as given on the command line.
+type profiles map[string]*pipelineFlags
+
+func (p profiles) String() string {
+	var names []string
+	for name := range p {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return strings.Join(names, ",")
+}
+
+func (p profiles) Set(s string) error {
+	name, args, ok := strings.Cut(s, "=")
+	if !ok || name == "" {
+		return fmt.Errorf("want name=flags, got %q", s)
+	}
+
+	fs := flag.NewFlagSet(name, flag.ContinueOnError)
+	fs.SetOutput(io.Discard)
+	cfg := newPipelineFlags(fs)
+	if err := fs.Parse(strings.Fields(args)); err != nil {
+		return fmt.Errorf("profile %s: %v", name, err)
+	}
+	if errs := cfg.validate(); len(errs) > 0 {
+		return fmt.Errorf("profile %s: %v", name, errors.Join(errs...))
+	}
+
+	p[name] = cfg
+	return nil
+}
+
+// switchProfile swaps in the named profile's pipeline and silences every
+// channel, notes started by the old pipeline would not be released by the
+// new one.
+func (m *MidiBridge) switchProfile(name string) {
+	build, ok := m.Profiles[name]
+	if !ok {
+		fmt.Printf("profile %s not configured\n", name)
+		return
+	}
+
+	fmt.Printf("Switching to profile %s\n", name)
+
+	m.pipeline.Lock()
+	defer m.pipeline.Unlock()
+
+	m.transforms = build()
+	m.profile = name
+	for _, msg := range panicMessages() {
+		m.Write(msg.Bytes())
+	}
+}
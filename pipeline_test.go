@@ -0,0 +1,77 @@
+package main
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestProfilesSet(t *testing.T) {
+	tests := []struct {
+		in      string
+		wantErr bool
+	}{
+		{in: "bend=-cc-to-pitchbend 1"},
+		{in: "quiet="},
+		{in: "soft=-soft-pedal 0.5 -transpose-cc 20 -transpose-range 12"},
+		{in: "-cc-to-pitchbend 1", wantErr: true},
+		{in: "=-cc-to-pitchbend 1", wantErr: true},
+		{in: "bad=-no-such-flag", wantErr: true},
+		{in: "bad=-cc-to-pitchbend 128", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		p := profiles{}
+		err := p.Set(tt.in)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("Set(%q) error %v, want error %v", tt.in, err, tt.wantErr)
+		}
+		if err == nil && len(p) != 1 {
+			t.Errorf("Set(%q) gave %d profiles", tt.in, len(p))
+		}
+	}
+}
+
+func TestSwitchProfile(t *testing.T) {
+	quiet(t)
+
+	configs := profiles{}
+	if err := configs.Set("bend=-cc-to-pitchbend 1"); err != nil {
+		t.Fatal(err)
+	}
+
+	m, out := testBridge(t, func(m *MidiBridge) {
+		m.Profiles = map[string]func() []Transform{
+			defaultProfile: func() []Transform { return nil },
+			"bend":         func() []Transform { return configs["bend"].transforms(m.release) },
+		}
+	})
+	var silence []byte
+	for _, msg := range panicMessages() {
+		silence = append(silence, msg.Bytes()...)
+	}
+
+	var want []byte
+	for _, s := range []struct {
+		req  []byte
+		want []byte
+	}{
+		{legacyPacket(0xB0, 1, 64), []byte{0xB0, 1, 64}},
+		{oscMessage(profileCall, "bend"), silence},
+		{legacyPacket(0xB0, 1, 64), []byte{0xE0, 0, 64}},
+		{oscMessage(profileCall, "missing"), nil},
+		{legacyPacket(0xB0, 1, 64), []byte{0xE0, 0, 64}},
+		{oscMessage(profileCall, defaultProfile), silence},
+		{legacyPacket(0xB0, 1, 64), []byte{0xB0, 1, 64}},
+	} {
+		m.handleCmd(s.req, nil)
+		want = append(want, s.want...)
+	}
+	m.Close()
+
+	if got := out.Bytes(); !bytes.Equal(got, want) {
+		t.Errorf("wrote % X\nwant  % X", got, want)
+	}
+	if m.profile != defaultProfile {
+		t.Errorf("profile %q, want %q", m.profile, defaultProfile)
+	}
+}
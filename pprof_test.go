@@ -0,0 +1,73 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestCheckLoopback(t *testing.T) {
+	tests := []struct {
+		addr string
+		ok   bool
+	}{
+		{"localhost:6060", true},
+		{"127.0.0.1:6060", true},
+		{"127.0.0.2:6060", true},
+		{"[::1]:6060", true},
+		{"0.0.0.0:6060", false},
+		{":6060", false},
+		{"192.168.1.10:6060", false},
+		{"example.com:6060", false},
+		{"127.0.0.1", false},
+	}
+	for _, tt := range tests {
+		if err := checkLoopback(tt.addr); (err == nil) != tt.ok {
+			t.Errorf("checkLoopback(%q) = %v, want ok %v", tt.addr, err, tt.ok)
+		}
+	}
+}
+
+func TestStartPprof(t *testing.T) {
+	for _, enabled := range []bool{true, false} {
+		t.Run(fmt.Sprintf("enabled %v", enabled), func(t *testing.T) {
+			quiet(t)
+
+			ln, _ := serialServer(t)
+			flags := map[string]string{"midi-in": "", "midi-out": tcpScheme + ln.Addr().String(), "pprof": ""}
+			if enabled {
+				flags["pprof"] = "127.0.0.1:0"
+			}
+			setFlags(t, flags)
+
+			s, err := start("127.0.0.1:0")
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer s.close()
+
+			if !enabled {
+				if s.pprof != nil {
+					t.Errorf("pprof listening on %s without -pprof", s.pprof.Addr())
+				}
+				return
+			}
+			if s.pprof == nil {
+				t.Fatal("pprof not listening")
+			}
+
+			resp, err := http.Get("http://" + s.pprof.Addr().String() + "/debug/pprof/")
+			if err != nil {
+				t.Fatal(err)
+			}
+			body, _ := io.ReadAll(resp.Body)
+			resp.Body.Close()
+
+			if resp.StatusCode != http.StatusOK || !strings.Contains(string(body), "goroutine") {
+				t.Errorf("index replied %s: %.100s", resp.Status, body)
+			}
+		})
+	}
+}
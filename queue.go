@@ -0,0 +1,210 @@
+package main
+
+import (
+	"fmt"
+	"sync"
+	"time"
+)
+
+// outQueue buffers messages for the midi out device so network commands
+// never block on a slow serial line.
+type outQueue struct {
+	mu     sync.Mutex
+	cond   *sync.Cond
+	items  []queued
+	closed bool
+	// wake interrupts sleep when a message is queued
+	wake chan struct{}
+
+	notesOnly bool
+}
+
+type queued struct {
+	data []byte
+	at   time.Time
+}
+
+func newOutQueue() *outQueue {
+	q := &outQueue{wake: make(chan struct{}, 1)}
+	q.cond = sync.NewCond(&q.mu)
+	return q
+}
+
+func (q *outQueue) push(data ...[]byte) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if q.closed {
+		return
+	}
+
+	now := time.Now()
+	for _, d := range data {
+		q.items = append(q.items, queued{d, now})
+	}
+	q.signal()
+}
+
+// thin queues continuous data. Once the queue is depth messages deep an
+// older value of the same stream still waiting is dropped and returned, so
+// only the final value of each stream gets written.
+func (q *outQueue) thin(data []byte, depth int) []byte {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if q.closed {
+		return nil
+	}
+
+	var dropped []byte
+	if len(q.items) >= depth {
+		for i := len(q.items) - 1; i >= 0; i-- {
+			if sameStream(q.items[i].data, data) {
+				dropped = q.items[i].data
+				q.items = append(q.items[:i], q.items[i+1:]...)
+				break
+			}
+		}
+	}
+
+	q.items = append(q.items, queued{data, time.Now()})
+	q.signal()
+
+	return dropped
+}
+
+// pop blocks until a message is queued and removes the first one wait
+// reports no wait for. If every message has to wait it removes none and
+// returns the shortest wait instead. It returns false once the queue is
+// closed and drained.
+func (q *outQueue) pop(wait func([]byte) time.Duration) (queued, time.Duration, bool) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	for len(q.items) == 0 && !q.closed {
+		q.cond.Wait()
+	}
+	if len(q.items) == 0 {
+		return queued{}, 0, false
+	}
+
+	var shortest time.Duration
+	for i, item := range q.items {
+		w := wait(item.data)
+		if w <= 0 {
+			if i == 0 && len(q.items) > 64 {
+				// shifting a backed up queue on every pop takes
+				// quadratic time, leave the space to the next grow
+				q.items = q.items[1:]
+			} else {
+				q.items = append(q.items[:i], q.items[i+1:]...)
+			}
+			return item, 0, true
+		}
+		if shortest == 0 || w < shortest {
+			shortest = w
+		}
+	}
+
+	return queued{}, shortest, true
+}
+
+func (q *outQueue) signal() {
+	q.cond.Signal()
+	select {
+	case q.wake <- struct{}{}:
+	default:
+	}
+}
+
+// sleep waits for d or until another message is queued, whichever comes
+// first.
+func (q *outQueue) sleep(d time.Duration) {
+	t := time.NewTimer(d)
+	defer t.Stop()
+
+	select {
+	case <-q.wake:
+	case <-t.C:
+	}
+}
+
+func (q *outQueue) close() {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	q.closed = true
+	q.cond.Broadcast()
+}
+
+// congested reports whether the queue is backed up. It turns true once the
+// queue is depth messages deep and false again once it drained to half of
+// that, so the state does not flap around the threshold.
+func (q *outQueue) congested(depth int) bool {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	switch {
+	case !q.notesOnly && len(q.items) >= depth:
+		q.notesOnly = true
+		fmt.Printf("Midi out congested at %d messages, forwarding notes only\n", len(q.items))
+	case q.notesOnly && len(q.items) <= depth/2:
+		q.notesOnly = false
+		fmt.Println("Midi out recovered, forwarding all messages")
+	}
+
+	return q.notesOnly
+}
+
+func isNote(data []byte) bool {
+	if len(data) == 0 {
+		return false
+	}
+	cmd := data[0] & 0xf0
+	return cmd == NoteOn || cmd == NoteOff
+}
+
+// releasesNote reports whether data is a note off, including note on with
+// velocity 0.
+func releasesNote(data []byte) bool {
+	if len(data) == 0 {
+		return false
+	}
+	cmd := data[0] & 0xf0
+	return cmd == NoteOff || cmd == NoteOn && len(data) > 2 && data[2] == 0
+}
+
+// suppressible are the messages dropped on a congested link: continuous
+// channel messages and real time clock.
+func suppressible(data []byte) bool {
+	if len(data) == 0 || isNote(data) {
+		return false
+	}
+	return data[0] < SysExC || data[0] >= 0xF8
+}
+
+// continuous are the channel messages sending a stream of values.
+func continuous(data []byte) bool {
+	if len(data) == 0 {
+		return false
+	}
+	switch data[0] & 0xf0 {
+	case Aftertouch, ContinuousContr, ChannelPressure, PitchBend:
+		return true
+	}
+	return false
+}
+
+func sameStream(a, b []byte) bool {
+	// an NRPN edit is never thinned, nor does it thin
+	if !continuous(a) || a[0] != b[0] || len(a) != len(b) {
+		return false
+	}
+	switch a[0] & 0xf0 {
+	case Aftertouch, ContinuousContr:
+		// poly aftertouch and controllers are one stream per note and
+		// controller number
+		return len(a) > 1 && len(b) > 1 && a[1] == b[1]
+	}
+	return true
+}
@@ -0,0 +1,350 @@
+package main
+
+import (
+	"bytes"
+	"testing"
+	"time"
+)
+
+// stalledOut holds every write to the midi out device until release is
+// closed, so messages back up in the queue behind it. Each write is sent
+// to started as it begins.
+type stalledOut struct {
+	midiOut
+	started chan []byte
+	release chan struct{}
+}
+
+func newStalledOut() *stalledOut {
+	return &stalledOut{started: make(chan []byte, 64), release: make(chan struct{})}
+}
+
+func (o *stalledOut) Write(p []byte) (int, error) {
+	o.started <- append([]byte(nil), p...)
+	<-o.release
+	return o.midiOut.Write(p)
+}
+
+// stalledBridge returns a bridge whose writer is stuck writing first.
+func stalledBridge(t *testing.T, setup func(m *MidiBridge), first []byte) (*MidiBridge, *stalledOut) {
+	t.Helper()
+
+	out := newStalledOut()
+	m := NewMidiBridge(nil, out)
+	if setup != nil {
+		setup(m)
+	}
+	t.Cleanup(m.Close)
+
+	m.Write(first)
+	select {
+	case <-out.started:
+	case <-time.After(5 * time.Second):
+		t.Fatal("first message never written")
+	}
+	return m, out
+}
+
+func ready([]byte) time.Duration { return 0 }
+
+func TestSuppressible(t *testing.T) {
+	tests := []struct {
+		data []byte
+		want bool
+	}{
+		{[]byte{0x90, 60, 100}, false},
+		{[]byte{0x80, 60, 0}, false},
+		{[]byte{0xB0, 7, 100}, true},
+		{[]byte{0xE3, 0, 64}, true},
+		{[]byte{0xD0, 10}, true},
+		{[]byte{0xC0, 5}, true},
+		{[]byte{0xF8}, true},
+		{[]byte{0xFE}, true},
+		{[]byte{0xF0, 0x7E, 0x7F, 0x06, 0x01, 0xF7}, false},
+		{[]byte{0xF2, 0, 0}, false},
+		{nil, false},
+	}
+	for _, tt := range tests {
+		if got := suppressible(tt.data); got != tt.want {
+			t.Errorf("suppressible(% X) = %v, want %v", tt.data, got, tt.want)
+		}
+	}
+}
+
+func TestQueueCongested(t *testing.T) {
+	q := newOutQueue()
+	quiet(t)
+
+	// queue length before the check and the state it reports
+	steps := []struct {
+		length int
+		want   bool
+	}{
+		{0, false},
+		{3, false},
+		{4, true},
+		{3, true},
+		{2, false},
+		{3, false},
+		{4, true},
+	}
+	for i, s := range steps {
+		for len(q.items) < s.length {
+			q.push([]byte{0xB0, 7, 0})
+		}
+		for len(q.items) > s.length {
+			q.pop(ready)
+		}
+		if got := q.congested(4); got != s.want {
+			t.Errorf("step %d at %d messages: congested %v, want %v", i, s.length, got, s.want)
+		}
+	}
+}
+
+func TestNotesPriority(t *testing.T) {
+	quiet(t)
+
+	note := []byte{0x90, 60, 100}
+	m, out := stalledBridge(t, func(m *MidiBridge) { m.NotesPriority = 2 }, note)
+	for _, data := range [][]byte{
+		{0xB0, 7, 1},
+		{0xB0, 7, 2},
+		// two queued, everything but notes is dropped now
+		{0xB0, 7, 3},
+		{0xF8},
+		{0x80, 60, 0},
+		{0xF0, 0x7E, 0x7F, 0x06, 0x01, 0xF7},
+	} {
+		m.Write(data)
+	}
+	close(out.release)
+	m.Close()
+
+	want := []byte{
+		0x90, 60, 100,
+		0xB0, 7, 1,
+		0xB0, 7, 2,
+		0x80, 60, 0,
+		0xF0, 0x7E, 0x7F, 0x06, 0x01, 0xF7,
+	}
+	if got := out.Bytes(); !bytes.Equal(got, want) {
+		t.Errorf("wrote % X\nwant  % X", got, want)
+	}
+}
+
+func TestSameStream(t *testing.T) {
+	tests := []struct {
+		a, b []byte
+		want bool
+	}{
+		{[]byte{0xB0, 7, 1}, []byte{0xB0, 7, 2}, true},
+		{[]byte{0xB0, 7, 1}, []byte{0xB0, 10, 1}, false},
+		{[]byte{0xB0, 7, 1}, []byte{0xB1, 7, 1}, false},
+		{[]byte{0xA0, 60, 1}, []byte{0xA0, 60, 9}, true},
+		{[]byte{0xA0, 60, 1}, []byte{0xA0, 62, 1}, false},
+		{[]byte{0xE0, 0, 64}, []byte{0xE0, 12, 70}, true},
+		{[]byte{0xD2, 10}, []byte{0xD2, 90}, true},
+		{[]byte{0x90, 60, 100}, []byte{0x90, 60, 90}, false},
+		{[]byte{0xC0, 1}, []byte{0xC0, 2}, false},
+		// an NRPN group is one write
+		{[]byte{0xB0, nrpnMSBCC, 1, 0xB0, nrpnLSBCC, 2}, []byte{0xB0, nrpnMSBCC, 1}, false},
+	}
+	for _, tt := range tests {
+		if got := sameStream(tt.a, tt.b); got != tt.want {
+			t.Errorf("sameStream(% X, % X) = %v, want %v", tt.a, tt.b, got, tt.want)
+		}
+	}
+}
+
+func TestQueueThin(t *testing.T) {
+	q := newOutQueue()
+
+	q.push([]byte{0x90, 60, 100})
+	if dropped := q.thin([]byte{0xB0, 7, 1}, 3); dropped != nil {
+		t.Errorf("thinned % X below depth", dropped)
+	}
+	q.thin([]byte{0xE0, 0, 64}, 3)
+	if dropped := q.thin([]byte{0xB0, 7, 2}, 3); !bytes.Equal(dropped, []byte{0xB0, 7, 1}) {
+		t.Errorf("thinned % X, want B0 07 01", dropped)
+	}
+	if dropped := q.thin([]byte{0xB0, 10, 2}, 3); dropped != nil {
+		t.Errorf("thinned % X with no older value of the stream", dropped)
+	}
+
+	var got []byte
+	for len(q.items) > 0 {
+		item, _, _ := q.pop(ready)
+		got = append(got, item.data...)
+	}
+	want := []byte{0x90, 60, 100, 0xE0, 0, 64, 0xB0, 7, 2, 0xB0, 10, 2}
+	if !bytes.Equal(got, want) {
+		t.Errorf("queued % X\nwant   % X", got, want)
+	}
+}
+
+func TestThin(t *testing.T) {
+	m, out := stalledBridge(t, func(m *MidiBridge) { m.Thin = 1 }, []byte{0x90, 60, 100})
+	for v := byte(0); v < 10; v++ {
+		m.Write([]byte{0xB0, 7, v})
+		m.Write([]byte{0xE0, 0, v})
+	}
+	m.Write([]byte{0x80, 60, 0})
+	close(out.release)
+	m.Close()
+
+	want := []byte{0x90, 60, 100, 0xB0, 7, 9, 0xE0, 0, 9, 0x80, 60, 0}
+	if got := out.Bytes(); !bytes.Equal(got, want) {
+		t.Errorf("wrote % X\nwant  % X", got, want)
+	}
+}
+
+func TestReleasesNote(t *testing.T) {
+	tests := []struct {
+		data []byte
+		want bool
+	}{
+		{[]byte{0x80, 60, 0}, true},
+		{[]byte{0x8F, 60, 64}, true},
+		{[]byte{0x90, 60, 0}, true},
+		{[]byte{0x90, 60, 1}, false},
+		{[]byte{0xB0, allNotesOffCC, 0}, false},
+		{[]byte{0x90, 60}, false},
+		{nil, false},
+	}
+	for _, tt := range tests {
+		if got := releasesNote(tt.data); got != tt.want {
+			t.Errorf("releasesNote(% X) = %v, want %v", tt.data, got, tt.want)
+		}
+	}
+}
+
+func TestMaxAge(t *testing.T) {
+	const maxAge = 20 * time.Millisecond
+
+	m, out := stalledBridge(t, func(m *MidiBridge) { m.MaxAge = maxAge }, []byte{0x90, 60, 100})
+	for _, data := range [][]byte{
+		{0xB0, 7, 100},
+		{0x90, 62, 100},
+		{0x80, 60, 0},
+		{0x90, 62, 0},
+	} {
+		m.Write(data)
+	}
+	time.Sleep(2 * maxAge)
+	close(out.release)
+
+	// fresh messages are written again
+	m.Write([]byte{0x90, 64, 100})
+	m.Close()
+
+	want := []byte{0x90, 60, 100, 0x80, 60, 0, 0x90, 62, 0, 0x90, 64, 100}
+	if got := out.Bytes(); !bytes.Equal(got, want) {
+		t.Errorf("wrote % X\nwant  % X", got, want)
+	}
+}
+
+func TestQueuePopWaits(t *testing.T) {
+	q := newOutQueue()
+	q.push([]byte{0x90, 60, 100}, []byte{0x91, 60, 100}, []byte{0x92, 60, 100})
+
+	waits := map[byte]time.Duration{0x90: 30 * time.Millisecond, 0x91: 10 * time.Millisecond}
+	wait := func(data []byte) time.Duration { return waits[data[0]] }
+
+	// a channel that has to wait doesn't hold up the others
+	item, w, ok := q.pop(wait)
+	if !ok || w != 0 || item.data[0] != 0x92 {
+		t.Fatalf("popped % X waiting %v, want 92 right away", item.data, w)
+	}
+	if item, w, _ = q.pop(wait); item.data != nil || w != 10*time.Millisecond {
+		t.Fatalf("popped % X waiting %v, want nothing for 10ms", item.data, w)
+	}
+
+	q.close()
+	waits = nil
+	for _, want := range []byte{0x90, 0x91} {
+		if item, _, ok = q.pop(wait); !ok || item.data[0] != want {
+			t.Fatalf("popped % X after close, want %02X", item.data, want)
+		}
+	}
+	if _, _, ok = q.pop(wait); ok {
+		t.Error("pop reports more after the queue drained")
+	}
+}
+
+// timedOut records when each write to the midi out device happened.
+type timedOut struct {
+	midiOut
+	writes []timedWrite
+}
+
+type timedWrite struct {
+	status byte
+	at     time.Time
+}
+
+func (o *timedOut) Write(p []byte) (int, error) {
+	o.mu.Lock()
+	o.writes = append(o.writes, timedWrite{p[0], time.Now()})
+	o.mu.Unlock()
+	return o.midiOut.Write(p)
+}
+
+func TestChannelGap(t *testing.T) {
+	const gap = 30 * time.Millisecond
+
+	out := &timedOut{}
+	m := NewMidiBridge(nil, out)
+	m.ChannelGap = gap
+	defer m.Close()
+
+	for _, data := range [][]byte{
+		{0x90, 60, 100},
+		{0x90, 62, 100},
+		{0x91, 60, 100},
+		{0xF8},
+		{0x90, 64, 100},
+	} {
+		m.Write(data)
+	}
+	m.Close()
+
+	want := []byte{0x90, 60, 100, 0x91, 60, 100, 0xF8, 0x90, 62, 100, 0x90, 64, 100}
+	if got := out.Bytes(); !bytes.Equal(got, want) {
+		t.Errorf("wrote % X\nwant  % X", got, want)
+	}
+
+	last := map[byte]time.Time{}
+	for _, w := range out.writes {
+		if prev, ok := last[w.status]; ok && w.at.Sub(prev) < gap {
+			t.Errorf("%02X written %v after the last one, want at least %v", w.status, w.at.Sub(prev), gap)
+		}
+		last[w.status] = w.at
+	}
+}
+
+func TestThruDelay(t *testing.T) {
+	const delay = 40 * time.Millisecond
+
+	out := &timedOut{}
+	m := NewMidiBridge(nil, out)
+	m.Delay = delay
+	defer m.Close()
+
+	var queued []time.Time
+	for _, data := range [][]byte{{0x90, 60, 100}, {0x91, 60, 100}, {0x92, 60, 100}} {
+		queued = append(queued, time.Now())
+		m.Write(data)
+		time.Sleep(delay / 4)
+	}
+	m.Close()
+
+	if len(out.writes) != len(queued) {
+		t.Fatalf("%d writes, want %d", len(out.writes), len(queued))
+	}
+	for i, w := range out.writes {
+		// the delay is constant, it doesn't add up over messages
+		if d := w.at.Sub(queued[i]); d < delay || d > 2*delay {
+			t.Errorf("%02X written after %v, want %v", w.status, d, delay)
+		}
+	}
+}
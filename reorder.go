@@ -0,0 +1,71 @@
+package main
+
+import (
+	"sync"
+	"time"
+)
+
+// orphanOffs holds back note offs that arrive before their note on, as
+// happens on links that reorder packets. A note on following within the
+// window is written with its note off right after it, otherwise the note
+// off is dropped.
+type orphanOffs struct {
+	mu   sync.Mutex
+	offs map[noteKey]*time.Timer
+	data map[noteKey][]byte
+}
+
+func newOrphanOffs() *orphanOffs {
+	return &orphanOffs{offs: map[noteKey]*time.Timer{}, data: map[noteKey][]byte{}}
+}
+
+func dataKey(data []byte) noteKey {
+	return noteKey{Channel: data[0] & 0x0f, Note: data[1]}
+}
+
+// hold keeps data for window, expired is called with it if no note on
+// claims it by then.
+func (o *orphanOffs) hold(data []byte, window time.Duration, expired func([]byte)) {
+	k := dataKey(data)
+
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	if t, ok := o.offs[k]; ok {
+		t.Stop()
+		expired(o.data[k])
+	}
+	o.data[k] = data
+	o.offs[k] = time.AfterFunc(window, func() {
+		o.mu.Lock()
+		data, ok := o.data[k]
+		delete(o.offs, k)
+		delete(o.data, k)
+		o.mu.Unlock()
+
+		if ok {
+			expired(data)
+		}
+	})
+}
+
+// claim returns the note off held for the note on in data, if any.
+func (o *orphanOffs) claim(data []byte) []byte {
+	if len(data) < 3 || data[0]&0xf0 != NoteOn || data[2] == 0 {
+		return nil
+	}
+	k := dataKey(data)
+
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	t, ok := o.offs[k]
+	if !ok {
+		return nil
+	}
+	t.Stop()
+	off := o.data[k]
+	delete(o.offs, k)
+	delete(o.data, k)
+	return off
+}
@@ -0,0 +1,105 @@
+package main
+
+import (
+	"bytes"
+	"testing"
+	"time"
+)
+
+func TestReorderWindow(t *testing.T) {
+	const window = 50 * time.Millisecond
+
+	var (
+		on   = []byte{0x90, 60, 100}
+		off  = []byte{0x80, 60, 0}
+		on2  = []byte{0x90, 62, 100}
+		off2 = []byte{0x80, 62, 0}
+	)
+
+	// each step writes data after waiting wait
+	type step struct {
+		wait time.Duration
+		data []byte
+	}
+	tests := []struct {
+		name  string
+		steps []step
+		want  []byte
+	}{
+		{
+			name:  "in order",
+			steps: []step{{0, on}, {0, off}},
+			want:  []byte{0x90, 60, 100, 0x80, 60, 0},
+		},
+		{
+			name:  "off before on within the window",
+			steps: []step{{0, off}, {10 * time.Millisecond, on}},
+			want:  []byte{0x90, 60, 100, 0x80, 60, 0},
+		},
+		{
+			name:  "off before on outside the window",
+			steps: []step{{0, off}, {2 * window, on}},
+			want:  []byte{0x90, 60, 100},
+		},
+		{
+			name:  "other notes are not held up",
+			steps: []step{{0, off}, {0, on2}, {0, off2}, {5 * time.Millisecond, on}},
+			want:  []byte{0x90, 62, 100, 0x80, 62, 0, 0x90, 60, 100, 0x80, 60, 0},
+		},
+		{
+			// a trill on a reordering link, the second note off arrives
+			// before its note on
+			name:  "repeated note",
+			steps: []step{{0, on}, {0, off}, {0, off}, {5 * time.Millisecond, on}},
+			want:  []byte{0x90, 60, 100, 0x80, 60, 0, 0x90, 60, 100, 0x80, 60, 0},
+		},
+		{
+			// a real duplicate only costs the next strike its length, it
+			// never leaves it hanging
+			name:  "off after all notes off",
+			steps: []step{{0, on}, {0, []byte{0xB0, allNotesOffCC, 0}}, {0, off}, {5 * time.Millisecond, on}},
+			want:  []byte{0x90, 60, 100, 0xB0, allNotesOffCC, 0, 0x90, 60, 100, 0x80, 60, 0},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m, out := testBridge(t, func(m *MidiBridge) { m.ReorderWindow = window })
+
+			for _, s := range tt.steps {
+				time.Sleep(s.wait)
+				m.Write(s.data)
+			}
+			time.Sleep(2 * window)
+			m.Close()
+
+			if got := out.Bytes(); !bytes.Equal(got, tt.want) {
+				t.Errorf("wrote % X, want % X", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestOrphanOffsExpire(t *testing.T) {
+	o := newOrphanOffs()
+
+	expired := make(chan []byte, 2)
+	o.hold([]byte{0x80, 60, 0}, time.Hour, func(off []byte) { expired <- off })
+	// a newer off for the same note replaces the older one
+	o.hold([]byte{0x80, 60, 1}, 10*time.Millisecond, func(off []byte) { expired <- off })
+
+	for _, want := range [][]byte{{0x80, 60, 0}, {0x80, 60, 1}} {
+		select {
+		case got := <-expired:
+			if !bytes.Equal(got, want) {
+				t.Errorf("expired % X, want % X", got, want)
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("% X never expired", want)
+		}
+	}
+
+	if off := o.claim([]byte{0x90, 60, 100}); off != nil {
+		t.Errorf("claimed expired % X", off)
+	}
+}
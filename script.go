@@ -0,0 +1,252 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// script rewrites or drops messages by rules, one per line or separated by
+// semicolons. A rule is any number of conditions followed by an action:
+//
+//	type=noteon note>=60 add note 12
+//	type=cc cc=1 drop
+//	channel=9 set channel 10
+//
+// Conditions compare a field with =, !=, <, <=, > or >=. The fields are
+// type, channel, note and velocity, cc and value name the same bytes for
+// controllers. Types are noteon, noteoff, aftertouch, cc, program,
+// pressure and bend. The actions are pass, drop, set field n and add
+// field n, a message set or added out of range is dropped. The first rule
+// whose conditions all hold decides, a message no rule matches passes.
+// Lines starting with # are comments.
+//
+// Rules can only look at and change the message they are given, so a
+// script can't reach outside the bridge, and each message is checked
+// against every rule at most once, so it can't hang the pipeline.
+type script struct {
+	rules []scriptRule
+}
+
+type scriptRule struct {
+	conds  []scriptCond
+	action string
+	field  string
+	n      int
+}
+
+type scriptCond struct {
+	field string
+	op    string
+	n     int
+}
+
+var scriptTypes = map[string]int{
+	"noteon":     NoteOn,
+	"noteoff":    NoteOff,
+	"aftertouch": Aftertouch,
+	"cc":         ContinuousContr,
+	"program":    PatchChange,
+	"pressure":   ChannelPressure,
+	"bend":       PitchBend,
+}
+
+var scriptFields = map[string]string{
+	"type":     "type",
+	"channel":  "channel",
+	"note":     "note",
+	"cc":       "note",
+	"velocity": "velocity",
+	"value":    "velocity",
+}
+
+// longer operators first so <= isn't taken for <
+var scriptOps = []string{"!=", "<=", ">=", "=", "<", ">"}
+
+// loadScript reads the rules in path.
+func loadScript(path string) (*script, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return parseScript(string(data))
+}
+
+func parseScript(src string) (*script, error) {
+	s := &script{}
+	for i, line := range strings.Split(src, "\n") {
+		for _, rule := range strings.Split(line, ";") {
+			fields := strings.Fields(rule)
+			if len(fields) == 0 {
+				continue
+			}
+			if strings.HasPrefix(fields[0], "#") {
+				break
+			}
+			r, err := parseScriptRule(fields)
+			if err != nil {
+				return nil, fmt.Errorf("line %d: %q: %v", i+1, strings.TrimSpace(rule), err)
+			}
+			s.rules = append(s.rules, r)
+		}
+	}
+	return s, nil
+}
+
+func parseScriptRule(fields []string) (scriptRule, error) {
+	var r scriptRule
+
+	for len(fields) > 0 {
+		c, ok, err := parseScriptCond(fields[0])
+		if err != nil {
+			return r, err
+		}
+		if !ok {
+			break
+		}
+		r.conds = append(r.conds, c)
+		fields = fields[1:]
+	}
+
+	if len(fields) == 0 {
+		return r, fmt.Errorf("no action")
+	}
+	r.action = fields[0]
+	switch r.action {
+	case "pass", "drop":
+		if len(fields) != 1 {
+			return r, fmt.Errorf("%s takes no arguments", r.action)
+		}
+	case "set", "add":
+		if len(fields) != 3 {
+			return r, fmt.Errorf("want %s field n", r.action)
+		}
+		field, ok := scriptFields[fields[1]]
+		if !ok || field == "type" {
+			return r, fmt.Errorf("can't %s %s", r.action, fields[1])
+		}
+		n, err := strconv.Atoi(fields[2])
+		if err != nil {
+			return r, fmt.Errorf("%q is not a number", fields[2])
+		}
+		r.field, r.n = field, n
+	default:
+		return r, fmt.Errorf("unknown action %q", r.action)
+	}
+
+	return r, nil
+}
+
+// parseScriptCond parses field op value, it reports false for anything
+// without an operator, which is where the action starts.
+func parseScriptCond(s string) (scriptCond, bool, error) {
+	var c scriptCond
+
+	for _, op := range scriptOps {
+		name, value, ok := strings.Cut(s, op)
+		if !ok {
+			continue
+		}
+		field, ok := scriptFields[name]
+		if !ok {
+			return c, false, fmt.Errorf("unknown field %q", name)
+		}
+		c.field, c.op = field, op
+
+		if field == "type" {
+			t, ok := scriptTypes[value]
+			if !ok || op != "=" && op != "!=" {
+				return c, false, fmt.Errorf("want type=name or type!=name, got %q", s)
+			}
+			c.n = t
+			return c, true, nil
+		}
+
+		n, err := strconv.Atoi(value)
+		if err != nil {
+			return c, false, fmt.Errorf("%q is not a number", value)
+		}
+		c.n = n
+		return c, true, nil
+	}
+
+	return c, false, nil
+}
+
+func (c scriptCond) holds(msg Midi) bool {
+	if c.field == "type" {
+		is := msg.Command() == byte(c.n)
+		switch c.n {
+		case NoteOn:
+			is = msg.isNoteOn()
+		case NoteOff:
+			is = msg.isNoteOff()
+		}
+		return is == (c.op == "=")
+	}
+
+	v := scriptGet(msg, c.field)
+	switch c.op {
+	case "=":
+		return v == c.n
+	case "!=":
+		return v != c.n
+	case "<":
+		return v < c.n
+	case "<=":
+		return v <= c.n
+	case ">":
+		return v > c.n
+	}
+	return v >= c.n
+}
+
+func scriptGet(msg Midi, field string) int {
+	switch field {
+	case "channel":
+		return int(msg.Channel)
+	case "note":
+		return int(msg.Note)
+	}
+	return int(msg.Velocity)
+}
+
+func (s *script) transform(msg Midi) []Midi {
+rules:
+	for _, r := range s.rules {
+		for _, c := range r.conds {
+			if !c.holds(msg) {
+				continue rules
+			}
+		}
+
+		switch r.action {
+		case "drop":
+			return nil
+		case "set", "add":
+			v := r.n
+			if r.action == "add" {
+				v += scriptGet(msg, r.field)
+			}
+			max := 127
+			if r.field == "channel" {
+				max = 15
+			}
+			if v < 0 || v > max {
+				return nil
+			}
+			switch r.field {
+			case "channel":
+				msg.Channel = byte(v)
+			case "note":
+				msg.Note = byte(v)
+			default:
+				msg.Velocity = byte(v)
+			}
+		}
+		return []Midi{msg}
+	}
+
+	return []Midi{msg}
+}
@@ -0,0 +1,131 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestScript(t *testing.T) {
+	tests := []struct {
+		name  string
+		src   string
+		steps []transformStep
+	}{
+		{
+			name: "transpose notes",
+			src:  "type=noteon add note 12\ntype=noteoff add note 12",
+			steps: []transformStep{
+				{noteOn(0, 60, 100), []Midi{noteOn(0, 72, 100)}},
+				{cc(0, 7, 90), []Midi{cc(0, 7, 90)}},
+				{noteOff(0, 60), []Midi{noteOff(0, 72)}},
+				{noteOn(0, 60, 0), []Midi{noteOn(0, 72, 0)}},
+				// out of range
+				{noteOn(0, 120, 100), nil},
+			},
+		},
+		{
+			name: "drop controllers",
+			src:  "type=cc drop",
+			steps: []transformStep{
+				{cc(0, 7, 90), nil},
+				{noteOn(1, 60, 100), []Midi{noteOn(1, 60, 100)}},
+			},
+		},
+		{
+			name: "first matching rule decides",
+			src: `# keep the modulation wheel, drop other controllers
+type=cc cc=1 pass; ; type=cc drop
+channel>=8 channel<=9 set channel 0
+type!=noteon type!=noteoff channel=3 drop
+velocity<10 type=noteon set velocity 10`,
+			steps: []transformStep{
+				{cc(0, 1, 90), []Midi{cc(0, 1, 90)}},
+				{cc(0, 7, 90), nil},
+				{noteOn(9, 60, 100), []Midi{noteOn(0, 60, 100)}},
+				{noteOn(10, 60, 100), []Midi{noteOn(10, 60, 100)}},
+				{bend(3, 100), nil},
+				{noteOn(3, 60, 5), []Midi{noteOn(3, 60, 10)}},
+				{noteOff(3, 60), []Midi{noteOff(3, 60)}},
+			},
+		},
+		{
+			name: "no rules",
+			src:  "\n# nothing\n",
+			steps: []transformStep{
+				{noteOn(0, 60, 100), []Midi{noteOn(0, 60, 100)}},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, err := parseScript(tt.src)
+			if err != nil {
+				t.Fatal(err)
+			}
+			runSteps(t, s.transform, tt.steps)
+		})
+	}
+}
+
+func TestParseScriptErrors(t *testing.T) {
+	for _, src := range []string{
+		"type=noteon",
+		"type=noteon transpose 12",
+		"type=chord drop",
+		"type<noteon drop",
+		"pitch=3 drop",
+		"note>=x drop",
+		"drop now",
+		"add note",
+		"add note x",
+		"set type 9",
+		"pass\nset pitch 3",
+	} {
+		if s, err := parseScript(src); err == nil {
+			t.Errorf("%q parsed as %+v", src, s.rules)
+		}
+	}
+}
+
+func TestLoadScript(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "rules")
+	if err := os.WriteFile(path, []byte("type=cc drop\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	s, err := loadScript(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []scriptRule{{conds: []scriptCond{{"type", "=", ContinuousContr}}, action: "drop"}}
+	if !reflect.DeepEqual(s.rules, want) {
+		t.Errorf("loaded %+v, want %+v", s.rules, want)
+	}
+
+	if _, err := loadScript(filepath.Join(t.TempDir(), "none")); err == nil {
+		t.Error("loaded a missing file")
+	}
+}
+
+func TestScriptInPipeline(t *testing.T) {
+	quiet(t)
+
+	s, err := parseScript("type=noteon add note 12; type=noteoff add note 12; type=cc drop")
+	if err != nil {
+		t.Fatal(err)
+	}
+	m, out := testBridge(t, func(m *MidiBridge) { m.Script = s })
+	m.handleCmd(legacyPacket(0x90, 60, 100), nil)
+	m.handleCmd(legacyPacket(0xB0, 7, 90), nil)
+	m.handleCmd(legacyPacket(0x80, 60, 0), nil)
+	m.Close()
+
+	want := []byte{0x90, 72, 100, 0x80, 72, 0}
+	if got := out.Bytes(); !bytes.Equal(got, want) {
+		t.Errorf("wrote % X, want % X", got, want)
+	}
+}
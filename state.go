@@ -0,0 +1,143 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"sort"
+	"sync"
+)
+
+const (
+	bankSelectMSB = 0
+	bankSelectLSB = 32
+)
+
+// ccShadow keeps the last controller value written to the midi out device
+// per channel and controller. Controllers that only mean something in
+// sequence with others are left out, see shadowed.
+type ccShadow struct {
+	mu     sync.Mutex
+	values map[noteKey]byte
+}
+
+// shadowCC is a controller value as it is stored in the state file.
+type shadowCC struct {
+	Channel    byte `json:"channel"`
+	Controller byte `json:"controller"`
+	Value      byte `json:"value"`
+}
+
+// savedState is what -state keeps across restarts.
+type savedState struct {
+	Profile string     `json:"profile"`
+	CC      []shadowCC `json:"cc"`
+}
+
+func newCCShadow() *ccShadow {
+	return &ccShadow{values: map[noteKey]byte{}}
+}
+
+// shadowed reports whether controller cc is state that can be sent again
+// on its own. Bank select needs its program change, data entry and
+// increment the parameter selected at the time, and channel mode
+// messages are commands.
+func shadowed(cc byte) bool {
+	switch cc {
+	case bankSelectMSB, bankSelectLSB:
+		return false
+	}
+	return !nrpnCC(cc) && cc < allSoundOffCC
+}
+
+func (s *ccShadow) update(data []byte) {
+	if len(data) != 3 || data[0]&0xf0 != ContinuousContr || !shadowed(data[1]) {
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.values[noteKey{Channel: data[0] & 0x0f, Note: data[1]}] = data[2]
+}
+
+func (s *ccShadow) list() []shadowCC {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	ccs := []shadowCC{}
+	for k, v := range s.values {
+		ccs = append(ccs, shadowCC{k.Channel, k.Note, v})
+	}
+	sort.Slice(ccs, func(i, j int) bool {
+		if ccs[i].Channel != ccs[j].Channel {
+			return ccs[i].Channel < ccs[j].Channel
+		}
+		return ccs[i].Controller < ccs[j].Controller
+	})
+
+	return ccs
+}
+
+// loadState reads a state file, a missing file is an empty state.
+func loadState(path string) (savedState, error) {
+	var s savedState
+
+	data, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return s, nil
+	}
+	if err != nil {
+		return s, err
+	}
+
+	return s, json.Unmarshal(data, &s)
+}
+
+// saveState writes the controller shadow and the active profile to
+// StatePath, replacing the file only once it is completely written.
+func (m *MidiBridge) saveState() error {
+	if m.StatePath == "" {
+		return nil
+	}
+
+	m.pipeline.Lock()
+	s := savedState{Profile: m.profile, CC: m.shadow.list()}
+	m.pipeline.Unlock()
+
+	data, err := json.Marshal(s)
+	if err != nil {
+		return err
+	}
+
+	tmp := m.StatePath + ".tmp"
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, m.StatePath)
+}
+
+// restoreState switches back to the saved profile and takes over the
+// saved controller values, with resend they are written to the midi out
+// device as well.
+func (m *MidiBridge) restoreState(s savedState, resend bool) {
+	if s.Profile != "" && s.Profile != defaultProfile {
+		m.switchProfile(s.Profile)
+	}
+
+	for _, cc := range s.CC {
+		if cc.Channel > 0x0f || cc.Controller > 0x7f || cc.Value > 0x7f {
+			fmt.Printf("ignoring saved controller %+v\n", cc)
+			continue
+		}
+
+		data := []byte{ContinuousContr | cc.Channel, cc.Controller, cc.Value}
+		if resend {
+			m.Write(data)
+		} else {
+			m.shadow.update(data)
+		}
+	}
+}
@@ -0,0 +1,116 @@
+package main
+
+import (
+	"bytes"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestShadowed(t *testing.T) {
+	tests := []struct {
+		cc   byte
+		want bool
+	}{
+		{1, true},
+		{7, true},
+		{64, true},
+		{119, true},
+		{bankSelectMSB, false},
+		{bankSelectLSB, false},
+		{dataEntryCC, false},
+		{dataEntryLSBCC, false},
+		{dataIncCC, false},
+		{dataDecCC, false},
+		{nrpnLSBCC, false},
+		{nrpnMSBCC, false},
+		{rpnLSBCC, false},
+		{rpnMSBCC, false},
+		{allSoundOffCC, false},
+		{allNotesOffCC, false},
+	}
+	for _, tt := range tests {
+		if got := shadowed(tt.cc); got != tt.want {
+			t.Errorf("shadowed(%d) = %v, want %v", tt.cc, got, tt.want)
+		}
+	}
+}
+
+func TestStateRoundTrip(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "state.json")
+
+	m, _ := testBridge(t, func(m *MidiBridge) {
+		m.StatePath = path
+		m.Profiles = map[string]func() []Transform{
+			defaultProfile: func() []Transform { return nil },
+			"pads":         func() []Transform { return nil },
+		}
+	})
+	m.switchProfile("pads")
+	for _, data := range [][]byte{
+		{0xB0, 7, 100},
+		{0xB0, 7, 90},
+		{0xB3, 74, 12},
+		{0xB0, bankSelectMSB, 1},
+		{0xB0, rpnMSBCC, 0},
+		{0xB0, dataEntryCC, 2},
+		{0x90, 60, 100},
+	} {
+		m.Write(data)
+	}
+	m.Close()
+
+	s, err := loadState(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the profile switch released the sustain pedal on every channel
+	want := savedState{Profile: "pads"}
+	for ch := byte(0); ch < 16; ch++ {
+		if ch == 0 {
+			want.CC = append(want.CC, shadowCC{Channel: 0, Controller: 7, Value: 90})
+		}
+		want.CC = append(want.CC, shadowCC{Channel: ch, Controller: sustainCC, Value: 0})
+		if ch == 3 {
+			want.CC = append(want.CC, shadowCC{Channel: 3, Controller: 74, Value: 12})
+		}
+	}
+	if !reflect.DeepEqual(s, want) {
+		t.Errorf("loaded %+v\nwant %+v", s, want)
+	}
+}
+
+func TestLoadStateMissing(t *testing.T) {
+	s, err := loadState(filepath.Join(t.TempDir(), "none.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s.Profile != "" || len(s.CC) != 0 {
+		t.Errorf("loaded %+v from a missing file", s)
+	}
+}
+
+func TestRestoreState(t *testing.T) {
+	saved := savedState{CC: []shadowCC{
+		{Channel: 0, Controller: 7, Value: 90},
+		{Channel: 2, Controller: 74, Value: 12},
+		{Channel: 16, Controller: 1, Value: 1},
+	}}
+
+	for _, resend := range []bool{false, true} {
+		m, out := testBridge(t, nil)
+		m.restoreState(saved, resend)
+		m.Close()
+
+		var want []byte
+		if resend {
+			want = []byte{0xB0, 7, 90, 0xB2, 74, 12}
+		}
+		if got := out.Bytes(); !bytes.Equal(got, want) {
+			t.Errorf("resend %v: wrote % X, want % X", resend, got, want)
+		}
+		if got := m.shadow.list(); !reflect.DeepEqual(got, saved.CC[:2]) {
+			t.Errorf("resend %v: shadow %+v, want %+v", resend, got, saved.CC[:2])
+		}
+	}
+}
@@ -0,0 +1,126 @@
+package main
+
+import "fmt"
+
+const (
+	SysExEnd = 0xF7
+
+	universalNonRealTime = 0x7E
+	allDevices           = 0x7F
+	generalInformation   = 0x06
+	identityRequestID    = 0x01
+	identityReplyID      = 0x02
+)
+
+var identityRequest = []byte{
+	SysExC, universalNonRealTime, allDevices,
+	generalInformation, identityRequestID,
+	SysExEnd,
+}
+
+type Identity struct {
+	Manufacturer []byte
+	Family       uint16
+	Member       uint16
+	Version      [4]byte
+}
+
+func (id Identity) String() string {
+	return fmt.Sprintf("manufacturer %X family %04X member %04X version %d.%d.%d.%d",
+		id.Manufacturer, id.Family, id.Member,
+		id.Version[0], id.Version[1], id.Version[2], id.Version[3])
+}
+
+// ParseIdentityReply decodes a Universal SysEx Identity Reply, msg has to
+// include the leading 0xF0 and the trailing 0xF7.
+func ParseIdentityReply(msg []byte) (Identity, bool) {
+	var id Identity
+
+	if len(msg) < 15 || msg[0] != SysExC || msg[len(msg)-1] != SysExEnd ||
+		msg[1] != universalNonRealTime ||
+		msg[3] != generalInformation || msg[4] != identityReplyID {
+		return id, false
+	}
+
+	body := msg[5 : len(msg)-1]
+
+	// extended manufacturer ids start with 0x00 followed by two bytes
+	mfrLen := 1
+	if body[0] == 0x00 {
+		mfrLen = 3
+	}
+	if len(body) != mfrLen+8 {
+		return id, false
+	}
+
+	id.Manufacturer = append([]byte(nil), body[:mfrLen]...)
+	body = body[mfrLen:]
+	id.Family = uint16(body[0]) | uint16(body[1])<<7
+	id.Member = uint16(body[2]) | uint16(body[3])<<7
+	copy(id.Version[:], body[4:8])
+
+	return id, true
+}
+
+// readSysEx collects SysEx messages from the in device byte stream, which
+// may split them over several reads. Real time bytes may be interleaved and
+// are skipped, any other status byte aborts the message.
+func (m *MidiBridge) readSysEx(data []byte) {
+	for _, b := range data {
+		switch {
+		case b == SysExC:
+			m.sysex = []byte{b}
+		case m.sysex == nil, b >= 0xF8:
+		case b == SysExEnd:
+			m.handleSysEx(append(m.sysex, b))
+			m.sysex = nil
+		case b&0x80 != 0:
+			m.sysex = nil
+		default:
+			m.sysex = append(m.sysex, b)
+		}
+	}
+}
+
+func (m *MidiBridge) handleSysEx(msg []byte) {
+	if id, ok := ParseIdentityReply(msg); ok {
+		fmt.Printf("Midi Device Identity: %s\n", id)
+
+		m.mu.Lock()
+		m.identity = &id
+		m.mu.Unlock()
+	}
+
+	if tc, ok := ParseFullFrame(msg); ok {
+		fmt.Printf("Midi Time Code: %s\n", tc)
+
+		m.mu.Lock()
+		m.timecode = &tc
+		m.mu.Unlock()
+	}
+
+	if sc, ok := ParseShowControl(msg); ok {
+		m.handleShowControl(sc)
+	}
+}
+
+// bridgeStatus is the reply to /status, what the midi in device told
+// about itself and the last timecode it sent. Empty until it did.
+type bridgeStatus struct {
+	Identity string `json:"identity,omitempty"`
+	Timecode string `json:"timecode,omitempty"`
+}
+
+func (m *MidiBridge) status() bridgeStatus {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	var s bridgeStatus
+	if m.identity != nil {
+		s.Identity = m.identity.String()
+	}
+	if m.timecode != nil {
+		s.Timecode = m.timecode.String()
+	}
+	return s
+}
@@ -0,0 +1,105 @@
+package main
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+// a Roland reply, family 0x011A member 0x0003 version 1.2.3.4
+var rolandIdentity = []byte{
+	0xF0, 0x7E, 0x10, 0x06, 0x02,
+	0x41,
+	0x1A, 0x02, 0x03, 0x00,
+	0x01, 0x02, 0x03, 0x04,
+	0xF7,
+}
+
+func TestParseIdentityReply(t *testing.T) {
+	tests := []struct {
+		name string
+		msg  []byte
+		want Identity
+		ok   bool
+	}{
+		{
+			name: "one byte manufacturer",
+			msg:  rolandIdentity,
+			want: Identity{Manufacturer: []byte{0x41}, Family: 0x011A, Member: 0x0003, Version: [4]byte{1, 2, 3, 4}},
+			ok:   true,
+		},
+		{
+			name: "extended manufacturer",
+			msg:  []byte{0xF0, 0x7E, 0x7F, 0x06, 0x02, 0x00, 0x20, 0x29, 0x05, 0x00, 0x10, 0x01, 0x00, 0x00, 0x02, 0x07, 0xF7},
+			want: Identity{Manufacturer: []byte{0x00, 0x20, 0x29}, Family: 0x0005, Member: 0x0090, Version: [4]byte{0, 0, 2, 7}},
+			ok:   true,
+		},
+		{
+			name: "identity request",
+			msg:  identityRequest,
+		},
+		{
+			name: "short body",
+			msg:  []byte{0xF0, 0x7E, 0x10, 0x06, 0x02, 0x41, 0x1A, 0x02, 0x03, 0x00, 0x01, 0x02, 0x03, 0xF7},
+		},
+		{
+			name: "unterminated",
+			msg:  rolandIdentity[:len(rolandIdentity)-1],
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := ParseIdentityReply(tt.msg)
+			if ok != tt.ok {
+				t.Fatalf("ok = %v, want %v", ok, tt.ok)
+			}
+			if ok && !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestIdentityInStatus(t *testing.T) {
+	conn := &packetConn{}
+	m, _ := testBridge(t, func(m *MidiBridge) { m.Conn = conn })
+
+	m.handleCmd([]byte(statusCall), udpAddr(1))
+
+	// split over reads, with a clock byte in between
+	m.readSysEx(rolandIdentity[:4])
+	m.readSysEx([]byte{0xF8})
+	m.readSysEx(rolandIdentity[4:])
+	m.handleCmd([]byte(statusCall), udpAddr(1))
+
+	want := []bridgeStatus{
+		{},
+		{Identity: "manufacturer 41 family 011A member 0003 version 1.2.3.4"},
+	}
+	sent := conn.packets()
+	if len(sent) != len(want) {
+		t.Fatalf("%d replies, want %d", len(sent), len(want))
+	}
+	for i, p := range sent {
+		var got bridgeStatus
+		if err := json.Unmarshal(p.data, &got); err != nil {
+			t.Fatal(err)
+		}
+		if got != want[i] {
+			t.Errorf("reply %d: %+v, want %+v", i, got, want[i])
+		}
+	}
+}
+
+func TestReadSysExAbortedByStatus(t *testing.T) {
+	m, _ := testBridge(t, nil)
+
+	m.readSysEx(rolandIdentity[:8])
+	m.readSysEx([]byte{0x90, 60, 100})
+	m.readSysEx(rolandIdentity[8:])
+
+	if s := m.status(); s.Identity != "" {
+		t.Errorf("identity %q from an aborted sysex", s.Identity)
+	}
+}
@@ -0,0 +1,74 @@
+package main
+
+// Transform rewrites a message on its way from the bridge to the midi out
+// device. Returning nil drops the message, returning several emits them all
+// in order.
+type Transform func(Midi) []Midi
+
+const pitchBendCenter = 8192
+
+// CCToPitchBend turns controller cc into pitch bend. Value 64 maps to the
+// bend center, 0 and 127 to the bend extents.
+func CCToPitchBend(cc byte) Transform {
+	return func(msg Midi) []Midi {
+		if msg.Command() != ContinuousContr || msg.Note != cc {
+			return []Midi{msg}
+		}
+
+		var bend int
+		if msg.Velocity <= 64 {
+			bend = int(msg.Velocity) << 7
+		} else {
+			bend = pitchBendCenter + (int(msg.Velocity)-64)*(16383-pitchBendCenter)/63
+		}
+
+		return []Midi{{
+			State:    PitchBend >> 4,
+			Channel:  msg.Channel,
+			Note:     byte(bend & 0x7f),
+			Velocity: byte(bend >> 7),
+		}}
+	}
+}
+
+// PitchBendToCC turns pitch bend into controller cc, keeping the 7 most
+// significant bits so the bend center lands on 64.
+func PitchBendToCC(cc byte) Transform {
+	return func(msg Midi) []Midi {
+		if msg.Command() != PitchBend {
+			return []Midi{msg}
+		}
+
+		bend := int(msg.Velocity)<<7 | int(msg.Note)
+
+		return []Midi{{
+			State:    ContinuousContr >> 4,
+			Channel:  msg.Channel,
+			Note:     cc,
+			Velocity: byte(bend >> 7),
+		}}
+	}
+}
+
+type noteKey struct {
+	Channel byte
+	Note    byte
+}
+
+func (m Midi) key() noteKey {
+	return noteKey{m.Channel, m.Note}
+}
+
+func (m Midi) isNoteOn() bool {
+	return m.Command() == NoteOn && m.Velocity > 0
+}
+
+// isNoteOff includes note on with velocity 0, which most devices send
+// instead of a note off.
+func (m Midi) isNoteOff() bool {
+	return m.Command() == NoteOff || m.Command() == NoteOn && m.Velocity == 0
+}
+
+func (m Midi) isCC(cc byte) bool {
+	return m.Command() == ContinuousContr && m.Note == cc
+}
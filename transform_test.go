@@ -0,0 +1,35 @@
+package main
+
+import "testing"
+
+func TestCCToPitchBend(t *testing.T) {
+	runSteps(t, CCToPitchBend(1), []transformStep{
+		{cc(0, 1, 0), []Midi{bend(0, 0)}},
+		{cc(0, 1, 32), []Midi{bend(0, 4096)}},
+		{cc(0, 1, 64), []Midi{bend(0, pitchBendCenter)}},
+		{cc(0, 1, 65), []Midi{bend(0, 8322)}},
+		{cc(3, 1, 127), []Midi{bend(3, maxPitchBend)}},
+		{cc(0, 2, 127), []Midi{cc(0, 2, 127)}},
+		{noteOn(0, 1, 100), []Midi{noteOn(0, 1, 100)}},
+	})
+}
+
+func TestPitchBendToCC(t *testing.T) {
+	runSteps(t, PitchBendToCC(1), []transformStep{
+		{bend(0, 0), []Midi{cc(0, 1, 0)}},
+		{bend(0, 127), []Midi{cc(0, 1, 0)}},
+		{bend(0, pitchBendCenter), []Midi{cc(0, 1, 64)}},
+		{bend(5, maxPitchBend), []Midi{cc(5, 1, 127)}},
+		{cc(0, 7, 90), []Midi{cc(0, 7, 90)}},
+	})
+}
+
+func TestPitchBendRoundTrip(t *testing.T) {
+	to, from := CCToPitchBend(1), PitchBendToCC(1)
+	for v := byte(0); v < 128; v++ {
+		got := from(to(cc(0, 1, v))[0])
+		if len(got) != 1 || got[0] != cc(0, 1, v) {
+			t.Errorf("cc %d came back as %+v", v, got)
+		}
+	}
+}
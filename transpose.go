@@ -0,0 +1,61 @@
+package main
+
+// Transpose shifts notes by an amount set live with controller cc. The
+// controller sweeps from -span to +span semitones, 64 is no transpose, and
+// is not forwarded itself. With release set, notes still held are released
+// when the amount changes, otherwise they keep sounding and get their note
+// off at the pitch they were started with.
+func Transpose(cc byte, span int, release bool) Transform {
+	amount := 0
+	playing := map[noteKey]byte{}
+
+	return func(msg Midi) []Midi {
+		switch {
+		case msg.isCC(cc):
+			v := int(msg.Velocity) - 64
+			next := v * span / 64
+			if v > 0 {
+				next = v * span / 63
+			}
+			if next == amount {
+				return nil
+			}
+			amount = next
+
+			if !release {
+				return nil
+			}
+			var out []Midi
+			for k, n := range playing {
+				out = append(out, Midi{State: NoteOff >> 4, Channel: k.Channel, Note: n})
+				delete(playing, k)
+			}
+			return out
+
+		case msg.isNoteOn():
+			n := int(msg.Note) + amount
+			if n < 0 || n > 127 {
+				return nil
+			}
+			playing[msg.key()] = byte(n)
+			msg.Note = byte(n)
+
+		case msg.isNoteOff():
+			n, ok := playing[msg.key()]
+			if !ok {
+				return nil
+			}
+			delete(playing, msg.key())
+			msg.Note = n
+
+		case msg.Command() == Aftertouch:
+			n, ok := playing[msg.key()]
+			if !ok {
+				return nil
+			}
+			msg.Note = n
+		}
+
+		return []Midi{msg}
+	}
+}
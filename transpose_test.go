@@ -0,0 +1,80 @@
+package main
+
+import "testing"
+
+func TestTranspose(t *testing.T) {
+	pressure := func(ch, note, v byte) Midi {
+		return Midi{State: Aftertouch >> 4, Channel: ch, Note: note, Velocity: v}
+	}
+
+	tests := []struct {
+		name    string
+		span    int
+		release bool
+		steps   []transformStep
+	}{
+		{
+			name: "controller sweeps the span",
+			span: 12,
+			steps: []transformStep{
+				{noteOn(0, 60, 100), []Midi{noteOn(0, 60, 100)}},
+				{noteOff(0, 60), []Midi{noteOff(0, 60)}},
+				{cc(0, 20, 127), nil},
+				{noteOn(0, 60, 100), []Midi{noteOn(0, 72, 100)}},
+				{noteOff(0, 60), []Midi{noteOff(0, 72)}},
+				{cc(0, 20, 0), nil},
+				{noteOn(0, 60, 100), []Midi{noteOn(0, 48, 100)}},
+				{noteOff(0, 60), []Midi{noteOff(0, 48)}},
+				{cc(0, 20, 64), nil},
+				{noteOn(0, 60, 100), []Midi{noteOn(0, 60, 100)}},
+			},
+		},
+		{
+			name: "held notes end at the pitch they started",
+			span: 12,
+			steps: []transformStep{
+				{noteOn(0, 60, 100), []Midi{noteOn(0, 60, 100)}},
+				{cc(0, 20, 127), nil},
+				{pressure(0, 60, 50), []Midi{pressure(0, 60, 50)}},
+				{noteOff(0, 60), []Midi{noteOff(0, 60)}},
+			},
+		},
+		{
+			name:    "release ends held notes on a change",
+			span:    12,
+			release: true,
+			steps: []transformStep{
+				{noteOn(0, 60, 100), []Midi{noteOn(0, 60, 100)}},
+				{cc(0, 20, 64), nil},
+				{cc(0, 20, 127), []Midi{noteOff(0, 60)}},
+				{noteOff(0, 60), nil},
+				{pressure(0, 60, 50), nil},
+			},
+		},
+		{
+			name: "notes shifted out of range are dropped",
+			span: 24,
+			steps: []transformStep{
+				{cc(0, 20, 127), nil},
+				{noteOn(0, 120, 100), nil},
+				{noteOff(0, 120), nil},
+				{noteOn(0, 100, 100), []Midi{noteOn(0, 124, 100)}},
+			},
+		},
+		{
+			name: "other messages pass",
+			span: 12,
+			steps: []transformStep{
+				{cc(0, 20, 127), nil},
+				{cc(0, 7, 90), []Midi{cc(0, 7, 90)}},
+				{noteOff(0, 62), nil},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			runSteps(t, Transpose(20, tt.span, tt.release), tt.steps)
+		})
+	}
+}
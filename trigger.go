@@ -0,0 +1,116 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+type TriggerMode int
+
+const (
+	TriggerSet TriggerMode = iota
+	TriggerToggle
+	TriggerMomentary
+)
+
+var triggerModes = map[string]TriggerMode{
+	"set":       TriggerSet,
+	"toggle":    TriggerToggle,
+	"momentary": TriggerMomentary,
+}
+
+// NoteTrigger turns a pad on Channel and Note into a switch for controller
+// CC. Value is the controller value sent by TriggerSet.
+type NoteTrigger struct {
+	Channel byte
+	Note    byte
+	CC      byte
+	Mode    TriggerMode
+	Value   byte
+}
+
+// noteTriggers is a flag.Value collecting channel:note:cc:mode[:value]
+// mappings.
+type noteTriggers []NoteTrigger
+
+func (t *noteTriggers) String() string {
+	var s []string
+	for _, tr := range *t {
+		for name, mode := range triggerModes {
+			if mode == tr.Mode {
+				s = append(s, fmt.Sprintf("%d:%d:%d:%s:%d", tr.Channel, tr.Note, tr.CC, name, tr.Value))
+			}
+		}
+	}
+	return strings.Join(s, ",")
+}
+
+func (t *noteTriggers) Set(s string) error {
+	parts := strings.Split(s, ":")
+	if len(parts) != 4 && len(parts) != 5 {
+		return fmt.Errorf("want channel:note:cc:mode[:value], got %q", s)
+	}
+
+	mode, ok := triggerModes[parts[3]]
+	if !ok {
+		return fmt.Errorf("unknown mode %q, want set, toggle or momentary", parts[3])
+	}
+	if len(parts) == 4 {
+		parts = append(parts, "127")
+	}
+
+	var n [4]byte
+	limits := [4]int{15, 127, 127, 127}
+	for i, p := range []string{parts[0], parts[1], parts[2], parts[4]} {
+		v, err := strconv.Atoi(p)
+		if err != nil || v < 0 || v > limits[i] {
+			return fmt.Errorf("%q out of range [0-%d]", p, limits[i])
+		}
+		n[i] = byte(v)
+	}
+
+	*t = append(*t, NoteTrigger{Channel: n[0], Note: n[1], CC: n[2], Mode: mode, Value: n[3]})
+	return nil
+}
+
+// NoteToCC swallows the notes of triggers and sends their controller
+// instead. Set sends Value on note on, toggle flips between 0 and 127 on
+// every note on and momentary sends 127 on note on and 0 on note off.
+func NoteToCC(triggers []NoteTrigger) Transform {
+	byKey := map[noteKey]NoteTrigger{}
+	for _, t := range triggers {
+		byKey[noteKey{t.Channel, t.Note}] = t
+	}
+	toggled := map[noteKey]bool{}
+
+	return func(msg Midi) []Midi {
+		if !msg.isNoteOn() && !msg.isNoteOff() {
+			return []Midi{msg}
+		}
+		t, ok := byKey[msg.key()]
+		if !ok {
+			return []Midi{msg}
+		}
+
+		cc := Midi{State: ContinuousContr >> 4, Channel: msg.Channel, Note: t.CC}
+
+		switch {
+		case t.Mode == TriggerSet && msg.isNoteOn():
+			cc.Velocity = t.Value
+		case t.Mode == TriggerToggle && msg.isNoteOn():
+			toggled[msg.key()] = !toggled[msg.key()]
+			if toggled[msg.key()] {
+				cc.Velocity = 127
+			}
+		case t.Mode == TriggerMomentary:
+			if msg.isNoteOn() {
+				cc.Velocity = 127
+			}
+		default:
+			return nil
+		}
+
+		return []Midi{cc}
+	}
+}
@@ -0,0 +1,94 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestNoteToCC(t *testing.T) {
+	tests := []struct {
+		name    string
+		trigger NoteTrigger
+		steps   []transformStep
+	}{
+		{
+			name:    "set sends the value on note on",
+			trigger: NoteTrigger{Channel: 9, Note: 36, CC: 80, Mode: TriggerSet, Value: 64},
+			steps: []transformStep{
+				{noteOn(9, 36, 100), []Midi{cc(9, 80, 64)}},
+				{noteOff(9, 36), nil},
+				{noteOn(9, 36, 100), []Midi{cc(9, 80, 64)}},
+			},
+		},
+		{
+			name:    "toggle flips on every note on",
+			trigger: NoteTrigger{Channel: 9, Note: 36, CC: 80, Mode: TriggerToggle},
+			steps: []transformStep{
+				{noteOn(9, 36, 100), []Midi{cc(9, 80, 127)}},
+				{noteOff(9, 36), nil},
+				{noteOn(9, 36, 100), []Midi{cc(9, 80, 0)}},
+				{noteOff(9, 36), nil},
+				{noteOn(9, 36, 100), []Midi{cc(9, 80, 127)}},
+			},
+		},
+		{
+			name:    "momentary follows the pad",
+			trigger: NoteTrigger{Channel: 9, Note: 36, CC: 80, Mode: TriggerMomentary},
+			steps: []transformStep{
+				{noteOn(9, 36, 100), []Midi{cc(9, 80, 127)}},
+				{noteOff(9, 36), []Midi{cc(9, 80, 0)}},
+				{noteOn(9, 36, 0), []Midi{cc(9, 80, 0)}},
+			},
+		},
+		{
+			name:    "other notes and channels pass",
+			trigger: NoteTrigger{Channel: 9, Note: 36, CC: 80, Mode: TriggerMomentary},
+			steps: []transformStep{
+				{noteOn(9, 38, 100), []Midi{noteOn(9, 38, 100)}},
+				{noteOn(0, 36, 100), []Midi{noteOn(0, 36, 100)}},
+				{cc(9, 36, 100), []Midi{cc(9, 36, 100)}},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			runSteps(t, NoteToCC([]NoteTrigger{tt.trigger}), tt.steps)
+		})
+	}
+}
+
+func TestNoteTriggersSet(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    NoteTrigger
+		wantErr bool
+	}{
+		{in: "9:36:80:toggle", want: NoteTrigger{9, 36, 80, TriggerToggle, 127}},
+		{in: "0:60:64:set:10", want: NoteTrigger{0, 60, 64, TriggerSet, 10}},
+		{in: "15:127:127:momentary:0", want: NoteTrigger{15, 127, 127, TriggerMomentary, 0}},
+		{in: "9:36:80", wantErr: true},
+		{in: "9:36:80:latch", wantErr: true},
+		{in: "16:36:80:set", wantErr: true},
+		{in: "9:128:80:set", wantErr: true},
+		{in: "9:36:80:set:x", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		var triggers noteTriggers
+		err := triggers.Set(tt.in)
+		if tt.wantErr {
+			if err == nil {
+				t.Errorf("Set(%q) = %+v, want error", tt.in, triggers)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("Set(%q): %v", tt.in, err)
+			continue
+		}
+		if !reflect.DeepEqual(triggers, noteTriggers{tt.want}) {
+			t.Errorf("Set(%q) = %+v, want %+v", tt.in, triggers, tt.want)
+		}
+	}
+}